@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"lootjestrekken/cmd/store"
+	"os"
+)
+
+// These commands work on a store that no server is using. While the server runs, bolt keeps the
+// database locked, use the /admin endpoints instead.
+
+func dryRunMigrations(storeurl string) error {
+	report, err := store.DryRunMigrations(storeurl)
+	if err != nil {
+		return err
+	}
+
+	if len(report) == 0 {
+		fmt.Println("The store is up to date")
+	}
+	for _, i := range report {
+		fmt.Println(i)
+	}
+	return nil
+}
+
+// checkStore prints what is wrong with the trekkingen of the store, if it can tell.
+func checkStore(storeurl string) error {
+	s, err := store.Open(storeurl)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s)
+
+	checker, ok := s.(store.Checker)
+	if !ok {
+		return fmt.Errorf("this store can't be checked")
+	}
+
+	problems := checker.Check()
+	for _, i := range problems {
+		fmt.Println(i)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d trekkingen can't be read", len(problems))
+	}
+	fmt.Println("All trekkingen can be read")
+	return nil
+}
+
+// backupStore writes a snapshot of the store to file.
+func backupStore(storeurl, file string) error {
+	s, err := store.Open(storeurl)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s)
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	n, err := store.Backup(s, f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	log.Infof("Backed up %d bytes to %s", n, file)
+	return f.Close()
+}
+
+// exportStore writes all trekkingen of the store to file as json.
+func exportStore(storeurl, file string) error {
+	s, err := store.Open(storeurl)
+	if err != nil {
+		return err
+	}
+	defer closeStore(s)
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Export(s, f); err != nil {
+		f.Close()
+		return err
+	}
+
+	log.Infof("Exported the store to %s", file)
+	return f.Close()
+}
+
+// importStore adds the trekkingen of an export in file to the store.
+func importStore(storeurl, file string) error {
+	s, err := store.Open(storeurl)
+	if err != nil {
+		return err
+	}
+	// what was imported is kept, also when the import stopped halfway
+	defer func() {
+		if err := closeStore(s); err != nil {
+			log.Errorf("Couldn't close the store: %v", err)
+		}
+	}()
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count, err := store.Import(s, f)
+	if err != nil {
+		return fmt.Errorf("imported %d trekkingen, then stopped: %w", count, err)
+	}
+
+	log.Infof("Imported %d trekkingen from %s", count, file)
+	return nil
+}
+
+// closeStore closes stores that need it, like a memory store that writes its snapshot when it is
+// closed.
+func closeStore(s store.Store) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
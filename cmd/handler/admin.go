@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/cmd/store"
+	"net/http"
+)
+
+// admin checks that the request comes with the admin secret. The admin endpoints don't exist when no
+// admin secret is configured.
+func (h *Handler) admin(r *http.Request) error {
+	if h.AdminSecret == "" {
+		return newHTTPError(http.StatusNotFound, "Admin endpoints are disabled, start the server with an admin secret")
+	}
+
+	secret := credential(r)
+	if secret == "" {
+		return newHTTPError(http.StatusUnauthorized, "This requires the admin secret")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(h.AdminSecret)) != 1 {
+		return newHTTPError(http.StatusForbidden, "This admin secret is not valid")
+	}
+	return nil
+}
+
+// Backup streams a consistent snapshot of the store, for stores that support it.
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	if err := h.admin(r); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	log.Info("Backing up the store")
+
+	if _, ok := h.Store.(store.Backuper); !ok {
+		http.Error(w, "This store doesn't support backups, use /admin/export", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="lootjestrekken.db"`)
+
+	// once the snapshot is being written the status can't change anymore
+	n, err := store.Backup(h.Store, w)
+	if err != nil {
+		log.Errorf("Backup failed after %d bytes: %v", n, err)
+		return
+	}
+	log.Infof("Backed up %d bytes", n)
+}
+
+// Export writes all trekkingen, including the trash, as json that Import can read into any store.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	if err := h.admin(r); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	log.Info("Exporting the store")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="lootjestrekken.json"`)
+
+	if err := store.Export(h.Store, w); err != nil {
+		log.Errorf("Export failed: %v", err)
+	}
+}
+
+// Import adds the trekkingen of an export that is posted as the body.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Post the export to import it", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.admin(r); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	log.Info("Importing into the store")
+
+	count, err := store.Import(h.Store, r.Body)
+	if err != nil {
+		log.Errorf("Import failed after %d trekkingen: %v", count, err)
+		if errors.Is(err, store.ErrExists) {
+			err = newHTTPError(http.StatusConflict, fmt.Sprintf("Imported %d trekkingen, then stopped: %v", count, err))
+		}
+		writeError(w, err, "Import failed")
+		return
+	}
+
+	_, err = w.Write([]byte(fmt.Sprintf("Imported %d trekkingen", count)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func (h *Handler) Commit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Committing to the draw of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	// the linked trekkingen are read before the transaction, the store can't be read while it runs
+	linked := h.linkedDraws(trekking)
+
+	var commitment string
+	ok := h.modify(w, r, name, "Failed to commit to trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		if err := inState(*trekking, lootjestrekken.Draft, lootjestrekken.Open, lootjestrekken.Closed); err != nil {
+			return err
+		}
+
+		if err := trekking.Commit(linked...); err != nil {
+			return err
+		}
+
+		commitment = trekking.Commitment
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err = w.Write([]byte(commitment))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) GetCommitment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting commitment of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	setETag(w, trekking)
+
+	if !trekking.Committed() {
+		writeError(w, lootjestrekken.ErrNotCommitted, "")
+		return
+	}
+
+	// the commitment covers the ids, the names are only there to recognize people by
+	ids := trekking.IDs()
+	sort.Strings(ids)
+	people := make([]string, 0, len(ids))
+	for _, i := range ids {
+		people = append(people, fmt.Sprintf("%s (%s)", i, trekking.DisplayName(i)))
+	}
+
+	_, err = w.Write([]byte(fmt.Sprintf("commitment: %s\npeople: %s", trekking.Commitment, strings.Join(people, ", "))))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) Reveal(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Revealing seed of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	// once revealed anyone can see the seed, so there is nothing left to change
+	if !trekking.Revealed {
+		ok := h.modify(w, r, name, "Failed to reveal seed", func(t *lootjestrekken.Trekking) error {
+			if err := h.authorize(r, *t); err != nil {
+				return err
+			}
+
+			if !t.Committed() {
+				return lootjestrekken.ErrNotCommitted
+			}
+
+			if err := inState(*t, lootjestrekken.Drawn, lootjestrekken.Revealed, lootjestrekken.Archived); err != nil {
+				return err
+			}
+
+			t.Revealed = true
+			trekking = *t
+			return nil
+		})
+		if !ok {
+			return
+		}
+	}
+
+	// the inputs are published as they were hashed, so anyone can check them against the commitment
+	// and replay the draw with lootjestrekken.VerifyInputs
+	inputs := []byte("{}")
+	if trekking.Inputs != nil {
+		inputs = trekking.Inputs.Encode()
+	}
+
+	_, err = w.Write([]byte(fmt.Sprintf("seed: %s\ninputs: %s", hex.EncodeToString(trekking.Seed), inputs)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
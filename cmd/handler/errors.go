@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"lootjestrekken/cmd/store"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+)
+
+// httpError is an error that a request should be answered with, with its status code.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func newHTTPError(status int, message string) error {
+	return &httpError{status: status, message: message}
+}
+
+// responses says how to answer the errors of the stores and of lootjestrekken.
+var responses = []struct {
+	err     error
+	status  int
+	message string
+}{
+	{store.ErrNotFound, http.StatusNotFound, "Couldn't find trekking"},
+	{store.ErrExists, http.StatusConflict, "A trekking with this name already exists"},
+	{store.ErrConflict, http.StatusConflict, "This trekking was changed by someone else at the same time, try again"},
+	{store.ErrEncrypted, http.StatusServiceUnavailable, "This trekking is encrypted and the server doesn't have its key"},
+	{store.ErrInvalidExport, http.StatusBadRequest, "This is not an export of lootjestrekken, or of a newer version"},
+	{lootjestrekken.ErrPersonNotFound, http.StatusNotFound, "This person is not part of this trekking"},
+	{lootjestrekken.ErrAmbiguousPerson, http.StatusConflict, "Several people in this trekking have this name, use their id"},
+	{lootjestrekken.ErrDuplicatePerson, http.StatusConflict, "This person is already part of this trekking"},
+	{lootjestrekken.ErrTooFewParticipants, http.StatusConflict, "A trekking needs at least two people to be getrokken"},
+	{lootjestrekken.ErrAlreadyDrawn, http.StatusConflict, "This trekking is already getrokken"},
+	{lootjestrekken.ErrNotDrawn, http.StatusConflict, "This trekking is not getrokken yet"},
+	{lootjestrekken.ErrNoValidAssignment, http.StatusConflict, "Couldn't trek trekking because no assignment satisfies the exclusion rules"},
+	{lootjestrekken.ErrSearchExhausted, http.StatusConflict, "Couldn't find an assignment that satisfies the exclusion rules in time, loosening them may help"},
+	{lootjestrekken.ErrNotCommitted, http.StatusNotFound, "This trekking has no commitment"},
+	{lootjestrekken.ErrCommitmentMismatch, http.StatusConflict, "The people, rules or earlier draws of this trekking changed since it was committed to"},
+	{lootjestrekken.ErrOrganizerExists, http.StatusConflict, "This trekking already has an organizer with this name"},
+	{lootjestrekken.ErrOrganizerNotFound, http.StatusNotFound, "Couldn't find organizer"},
+	{lootjestrekken.ErrInvalidTransition, http.StatusConflict, "This trekking can't move to that state"},
+}
+
+// writeError answers a request with an error. Errors that don't say how to answer them are
+// answered with failmsg and 500.
+func writeError(w http.ResponseWriter, err error, failmsg string) {
+	var e *httpError
+	if errors.As(err, &e) {
+		if e.status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, e.message, e.status)
+		return
+	}
+
+	for _, i := range responses {
+		if errors.Is(err, i.err) {
+			http.Error(w, i.message, i.status)
+			return
+		}
+	}
+
+	http.Error(w, failmsg, http.StatusInternalServerError)
+}
@@ -8,11 +8,26 @@ import (
 	"lootjestrekken/cmd/store"
 	"lootjestrekken/pkg/lootjestrekken"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 type Handler struct {
-	Store store.Store
+	Store      store.Store
+	Randomness lootjestrekken.Randomness
+	// Retention is how long deleted trekkingen stay in the trash.
+	Retention time.Duration
+	// AdminSecret gives access to the admin endpoints. Without it they are disabled.
+	AdminSecret string
+}
+
+// randomness returns the configured randomness, or the default one if none was configured.
+func (h *Handler) randomness() lootjestrekken.Randomness {
+	if h.Randomness == nil {
+		return lootjestrekken.DefaultRandomness
+	}
+	return h.Randomness
 }
 
 func (h *Handler) NewTrekking(w http.ResponseWriter, r *http.Request) {
@@ -26,16 +41,19 @@ func (h *Handler) NewTrekking(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("Creating new trekking with name %s", name)
 
-	if err := h.Store.AddTrekking(name, lootjestrekken.Trekking{}); err != nil {
-		if err == store.ErrExists {
-			http.Error(w, "Couldn't create trekking because trekking with this name already exists", http.StatusConflict)
-		} else {
-			http.Error(w, "Couldn't create trekking", http.StatusInternalServerError)
-		}
+	trekking := lootjestrekken.Trekking{}
+	secret, err := trekking.AddOrganizer(OwnerName)
+	if err != nil {
+		http.Error(w, "Couldn't create trekking", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Store.AddTrekking(name, trekking); err != nil {
+		writeError(w, err, "Couldn't create trekking")
 		return
 	}
 
-	_, err := w.Write([]byte(fmt.Sprintf("New trekking created with name %s", name)))
+	_, err = w.Write([]byte(fmt.Sprintf("New trekking created with name %s. Your organizer secret, keep it secret: %s", name, secret)))
 	if err != nil {
 		log.Errorf("Couldn't write %v", err)
 	}
@@ -64,15 +82,26 @@ func (h *Handler) RawTrekking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debug("getting raw trekking named %s", name)
+	log.Debugf("getting raw trekking named %s", name)
 
 	trekking, err := h.Store.GetTrekking(name)
-
 	if err != nil {
-		http.Error(w, "Couldn't find trekking", http.StatusNotFound)
+		writeError(w, err, "Couldn't read trekking")
 		return
 	}
 
+	setETag(w, trekking)
+
+	if err := h.authorize(r, trekking); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	// the seed of an auditable draw stays secret until it is revealed
+	if !trekking.Revealed {
+		trekking.Seed = nil
+	}
+
 	err = json.NewEncoder(w).Encode(trekking)
 	if err != nil {
 		log.Printf("Couldn't write %v", err)
@@ -87,18 +116,17 @@ func (h *Handler) GetPeople(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debug("getting people associated with trekking %s", name)
+	log.Debugf("getting people associated with trekking %s", name)
 
 	trekking, err := h.Store.GetTrekking(name)
-
 	if err != nil {
-		http.Error(w, "Couldn't find trekking", http.StatusNotFound)
+		writeError(w, err, "Couldn't read trekking")
 		return
 	}
 
-	people := trekking.People
+	setETag(w, trekking)
 
-	_, err = w.Write([]byte(strings.Join(people, "\n")))
+	_, err = w.Write([]byte(strings.Join(trekking.Names(), "\n")))
 	if err != nil {
 		log.Printf("Couldn't write %v", err)
 	}
@@ -115,26 +143,38 @@ func (h *Handler) AddPerson(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("Adding person %s to trekking %s", personname, trekkingname)
 
-	trekking, err := h.Store.GetTrekking(trekkingname)
+	var person lootjestrekken.Participant
+	var token string
+	ok := h.addPeople(w, r, trekkingname, "Failed to add person to trekking", func(trekking *lootjestrekken.Trekking) error {
+		// once sign-up isn't open, only organizers can add people
+		if trekking.State != lootjestrekken.Open {
+			if err := h.authorize(r, *trekking); err != nil {
+				return err
+			}
+		}
 
-	if err != nil {
-		http.Error(w, "Couldn't find trekking", http.StatusNotFound)
-		return
-	}
+		if err := inState(*trekking, lootjestrekken.Draft, lootjestrekken.Open, lootjestrekken.Closed); err != nil {
+			return err
+		}
 
-	if trekking.Getrokken {
-		http.Error(w, "This trekking is already getrokken", http.StatusConflict)
-		return
-	}
+		if trekking.Committed() {
+			return newHTTPError(http.StatusConflict, "The people of this trekking are already committed to")
+		}
 
-	trekking.AddPerson(personname)
-	err = h.Store.UpdateTrekking(trekking)
-	if err != nil {
-		http.Error(w, "Failed to add person to trekking", http.StatusBadRequest)
+		var err error
+		person, err = trekking.AddPerson(personname)
+		if err != nil {
+			return err
+		}
+
+		token, err = trekking.IssueToken(person.ID)
+		return err
+	})
+	if !ok {
 		return
 	}
 
-	_, err = w.Write([]byte("Added succesfully"))
+	_, err := w.Write([]byte(fmt.Sprintf("Added succesfully. Your personal link, keep it secret: %s", personalLink(trekkingname, person.ID, token))))
 	if err != nil {
 		log.Printf("Couldn't write %v", err)
 	}
@@ -151,26 +191,26 @@ func (h *Handler) RemovePerson(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("Removing person %s from trekking %s", personname, trekkingname)
 
-	trekking, err := h.Store.GetTrekking(trekkingname)
+	ok := h.modify(w, r, trekkingname, "Failed to remove person to trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
 
-	if err != nil {
-		http.Error(w, "Couldn't find trekking", http.StatusNotFound)
-		return
-	}
+		if err := inState(*trekking, lootjestrekken.Draft, lootjestrekken.Open, lootjestrekken.Closed); err != nil {
+			return err
+		}
 
-	if trekking.Getrokken {
-		http.Error(w, "This trekking is already getrokken", http.StatusConflict)
-		return
-	}
+		if trekking.Committed() {
+			return newHTTPError(http.StatusConflict, "The people of this trekking are already committed to")
+		}
 
-	trekking.RemovePerson(personname)
-	err = h.Store.UpdateTrekking(trekking)
-	if err != nil {
-		http.Error(w, "Failed to remove person to trekking", http.StatusBadRequest)
+		return trekking.RemovePerson(personname)
+	})
+	if !ok {
 		return
 	}
 
-	_, err = w.Write([]byte("Removed succesfully"))
+	_, err := w.Write([]byte("Removed succesfully"))
 	if err != nil {
 		log.Printf("Couldn't write %v", err)
 	}
@@ -184,14 +224,29 @@ func (h *Handler) Trek(w http.ResponseWriter, r *http.Request) {
 
 	trekking, err := h.Store.GetTrekking(name)
 	if err != nil {
-		http.Error(w, "Couldn't find trekking", http.StatusNotFound)
+		writeError(w, err, "Couldn't read trekking")
 		return
 	}
 
-	trekking.Trek()
-	err = h.Store.UpdateTrekking(trekking)
-	if err != nil {
-		http.Error(w, "Failed to trek trekking", http.StatusBadRequest)
+	// the linked trekkingen are read before the transaction, the store can't be read while it runs
+	linked := h.linkedDraws(trekking)
+
+	ok := h.modify(w, r, name, "Failed to trek trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		if err := inState(*trekking, lootjestrekken.Closed); err != nil {
+			return err
+		}
+
+		if err := h.trek(trekking, linked); err != nil {
+			return err
+		}
+
+		return trekking.Transition(lootjestrekken.Drawn)
+	})
+	if !ok {
 		return
 	}
 
@@ -201,6 +256,20 @@ func (h *Handler) Trek(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// trek draws a trekking, from its seed if it is committed to.
+func (h *Handler) trek(trekking *lootjestrekken.Trekking, linked []lootjestrekken.PastDraw) error {
+	if trekking.Committed() {
+		return trekking.TrekCommitted(linked...)
+	}
+	return trekking.TrekWith(h.randomness(), linked...)
+}
+
+// personalLink is the link at which a person can see who they have getrokken. It refers to them by
+// id, so it keeps working when they are renamed or someone with the same name joins.
+func personalLink(trekkingname, id, token string) string {
+	return fmt.Sprintf("/t/%s/people/%s/getrokken?token=%s", url.PathEscape(trekkingname), url.PathEscape(id), url.QueryEscape(token))
+}
+
 func (h *Handler) Getrokken(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	trekkingname := vars["trekking-name"]
@@ -214,22 +283,28 @@ func (h *Handler) Getrokken(w http.ResponseWriter, r *http.Request) {
 
 	trekking, err := h.Store.GetTrekking(trekkingname)
 	if err != nil {
-		http.Error(w, "Couldn't find trekking", http.StatusNotFound)
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	person, err := trekking.Participant(personname)
+	if err != nil || !trekking.CheckToken(person.ID, r.URL.Query().Get("token")) {
+		http.Error(w, "This is not your personal link", http.StatusForbidden)
 		return
 	}
 
-	if !trekking.Getrokken {
-		http.Error(w, "This trekking is not yet getrokken", http.StatusConflict)
+	if err := inState(trekking, lootjestrekken.Drawn, lootjestrekken.Revealed, lootjestrekken.Archived); err != nil {
+		writeError(w, err, "")
 		return
 	}
 
-	getrokken, err := trekking.GetrokkenPerson(personname)
+	getrokken, err := trekking.GetrokkenPerson(person.ID)
 	if err != nil {
-		http.Error(w, "You are not part of this trekking", http.StatusNotFound)
+		writeError(w, err, "Failed to look up getrokken person")
 		return
 	}
 
-	_, err = w.Write([]byte(fmt.Sprintf("You have getrokken: %s", getrokken)))
+	_, err = w.Write([]byte(fmt.Sprintf("You have getrokken: %s", getrokken.Name)))
 	if err != nil {
 		log.Printf("Couldn't write %v", err)
 	}
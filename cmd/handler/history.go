@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// linkedDraws collects the results of the linked earlier trekkingen that have been getrokken.
+func (h *Handler) linkedDraws(trekking lootjestrekken.Trekking) []lootjestrekken.PastDraw {
+	draws := make([]lootjestrekken.PastDraw, 0, len(trekking.Previous))
+	for _, name := range trekking.Previous {
+		previous, err := h.Store.GetTrekking(name)
+		if err != nil {
+			log.Warnf("Couldn't find previous trekking %s of %s: %v", name, trekking.Name, err)
+			continue
+		}
+
+		if previous.Getrokken {
+			draws = append(draws, trekking.LinkedDraw(previous))
+		}
+	}
+
+	return draws
+}
+
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting history of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	setETag(w, trekking)
+
+	// the history tells who drew whom in earlier years
+	if err := h.authorize(r, trekking); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	lines := make([]string, 0)
+	for _, i := range trekking.Previous {
+		lines = append(lines, fmt.Sprintf("previous: %s", i))
+	}
+	for index, d := range trekking.History {
+		pairs := make([]string, 0, len(d.People))
+		for pindex, p := range d.People {
+			if pindex < len(d.PeopleMapping) {
+				pairs = append(pairs, fmt.Sprintf("%s -> %s", trekking.DisplayName(p), trekking.DisplayName(d.PeopleMapping[pindex])))
+			}
+		}
+		if d.At.IsZero() {
+			lines = append(lines, fmt.Sprintf("history %d: %s", index, strings.Join(pairs, ", ")))
+		} else {
+			lines = append(lines, fmt.Sprintf("history %d (%s): %s", index, d.At.Format("2006-01-02"), strings.Join(pairs, ", ")))
+		}
+	}
+	if trekking.HistoryYears > 0 {
+		lines = append(lines, fmt.Sprintf("years: %d", trekking.HistoryYears))
+	}
+
+	_, err = w.Write([]byte(strings.Join(lines, "\n")))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) AddHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	if trekkingname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var draw lootjestrekken.PastDraw
+	if err := json.NewDecoder(r.Body).Decode(&draw); err != nil || len(draw.People) != len(draw.PeopleMapping) {
+		http.Error(w, "Bad request, expected a json object with People and PeopleMapping of equal length", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Adding earlier draw to history of trekking %s", trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to add history to trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		trekking.AddHistory(draw)
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Added succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) SetHistoryYears(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	years, err := strconv.Atoi(vars["years"])
+	if trekkingname == "" || err != nil || years < 0 {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Setting history years of trekking %s to %d", trekkingname, years)
+
+	ok := h.modify(w, r, trekkingname, "Failed to update trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		trekking.HistoryYears = years
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err = w.Write([]byte("Updated succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) LinkPrevious(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	previous := vars["previous"]
+	if trekkingname == "" || previous == "" || trekkingname == previous {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Linking previous trekking %s to trekking %s", previous, trekkingname)
+
+	if _, err := h.Store.GetTrekking(previous); err != nil {
+		http.Error(w, "Couldn't find previous trekking", http.StatusNotFound)
+		return
+	}
+
+	ok := h.modify(w, r, trekkingname, "Failed to link previous trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		trekking.LinkPrevious(previous)
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Linked succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) UnlinkPrevious(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	previous := vars["previous"]
+	if trekkingname == "" || previous == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Unlinking previous trekking %s from trekking %s", previous, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to unlink previous trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		if !trekking.UnlinkPrevious(previous) {
+			return newHTTPError(http.StatusNotFound, "Couldn't find linked trekking")
+		}
+
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Unlinked succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"strings"
+)
+
+// inState checks that the trekking is in one of the given states. If it isn't, it returns a 409
+// error.
+func inState(trekking lootjestrekken.Trekking, states ...lootjestrekken.State) error {
+	names := make([]string, 0, len(states))
+	for _, i := range states {
+		if trekking.State == i {
+			return nil
+		}
+		names = append(names, i.String())
+	}
+
+	return newHTTPError(http.StatusConflict, fmt.Sprintf("This trekking is %s, this is only possible when it is %s", trekking.State, strings.Join(names, " or ")))
+}
+
+// setup checks that an organizer asks to change the setup of a trekking, and that it is still being
+// set up and not committed to.
+func (h *Handler) setup(r *http.Request, trekking lootjestrekken.Trekking) error {
+	if err := h.authorize(r, trekking); err != nil {
+		return err
+	}
+
+	if err := inState(trekking, lootjestrekken.Draft, lootjestrekken.Open, lootjestrekken.Closed); err != nil {
+		return err
+	}
+
+	if trekking.Committed() {
+		return newHTTPError(http.StatusConflict, "The rules of this trekking are already committed to")
+	}
+	return nil
+}
+
+func (h *Handler) GetState(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting state of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	setETag(w, trekking)
+
+	_, err = w.Write([]byte(trekking.State.String()))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) SetState(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	state, err := lootjestrekken.ParseState(vars["state"])
+	if trekkingname == "" || err != nil {
+		http.Error(w, "Bad request, expected one of draft, open, closed, revealed or archived", http.StatusBadRequest)
+		return
+	}
+
+	// a trekking only becomes drawn by treking it
+	if state == lootjestrekken.Drawn {
+		http.Error(w, "Use trek to draw a trekking", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Moving trekking %s to state %s", trekkingname, state)
+
+	ok := h.modify(w, r, trekkingname, "Failed to update trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		if err := trekking.Transition(state); err != nil {
+			return newHTTPError(http.StatusConflict, fmt.Sprintf("This trekking is %s and can't become %s", trekking.State, state))
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err = w.Write([]byte("Updated succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+// Redraw draws a drawn trekking again. Everyone has to look up their result again, so every redraw
+// is recorded with who did it and why.
+func (h *Handler) Redraw(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	reason := r.URL.Query().Get("reason")
+	if name == "" || reason == "" {
+		http.Error(w, "Bad request, a redraw needs a reason", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Redrawing trekking with name %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	// the linked trekkingen are read before the transaction, the store can't be read while it runs
+	linked := h.linkedDraws(trekking)
+
+	ok := h.modify(w, r, name, "Failed to trek trekking", func(trekking *lootjestrekken.Trekking) error {
+		organizer, err := h.organizer(r, *trekking)
+		if err != nil {
+			return err
+		}
+
+		if err := inState(*trekking, lootjestrekken.Drawn); err != nil {
+			return err
+		}
+
+		// an auditable draw follows from its seed, so drawing it again gives the same result
+		if trekking.Committed() {
+			return newHTTPError(http.StatusConflict, "An auditable trekking can't be redrawn")
+		}
+
+		if err := h.trek(trekking, linked); err != nil {
+			return err
+		}
+
+		trekking.RecordRedraw(organizer, reason)
+		log.Warnf("Trekking %s was redrawn by %q because: %s", name, organizer, reason)
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err = w.Write([]byte("Trekking successfully getrokken again. "))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
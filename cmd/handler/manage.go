@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/cmd/store"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DeleteTrekking moves a trekking to the trash, from which it can be restored until the retention
+// window has passed.
+func (h *Handler) DeleteTrekking(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Deleting trekking with name %s", name)
+
+	err := h.Store.DeleteTrekking(name, h.checkChange(r))
+	if errors.Is(err, store.ErrExists) {
+		err = newHTTPError(http.StatusConflict, "A trekking with this name is already in the trash, rename this one to delete it")
+	}
+	if err != nil {
+		writeError(w, err, "Failed to delete trekking")
+		return
+	}
+
+	_, err = w.Write([]byte(fmt.Sprintf("Moved to the trash, it can be restored for %s", h.Retention)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) RenameTrekking(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	newname := vars["new-name"]
+	if name == "" || newname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Renaming trekking with name %s to %s", name, newname)
+
+	if err := h.Store.RenameTrekking(name, newname, h.checkChange(r)); err != nil {
+		writeError(w, err, "Failed to rename trekking")
+		return
+	}
+
+	_, err := w.Write([]byte(fmt.Sprintf("Trekking renamed to %s", newname)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+// CloneTrekking starts a new trekking with the people and settings of an existing one, for example
+// for next year's event. Organizers of the existing trekking also organize the clone.
+func (h *Handler) CloneTrekking(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	newname := vars["new-name"]
+	if name == "" || newname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Cloning trekking with name %s to %s", name, newname)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	if err := h.authorize(r, trekking); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	if err := h.Store.CloneTrekking(name, newname); err != nil {
+		writeError(w, err, "Failed to clone trekking")
+		return
+	}
+
+	_, err = w.Write([]byte(fmt.Sprintf("Trekking cloned to %s", newname)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+// IssueLink gives a person a new personal link, for example after cloning a trekking. Their old
+// link stops working.
+func (h *Handler) IssueLink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	personname := vars["name"]
+	if trekkingname == "" || personname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Issuing a new link to person %s in trekking %s", personname, trekkingname)
+
+	var person lootjestrekken.Participant
+	var token string
+	ok := h.modify(w, r, trekkingname, "Failed to issue link", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		var err error
+		person, err = trekking.Participant(personname)
+		if err != nil {
+			return err
+		}
+
+		token, err = trekking.IssueToken(person.ID)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte(fmt.Sprintf("The personal link of %s, keep it secret: %s", person.Name, personalLink(trekkingname, person.ID, token))))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+// purgeTrash permanently removes the trekkingen that have been in the trash longer than the
+// retention window.
+func (h *Handler) purgeTrash() error {
+	return h.Store.PurgeTrash(time.Now().Add(-h.Retention))
+}
+
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	log.Debug("listing all trashed trekkingen")
+
+	if err := h.purgeTrash(); err != nil {
+		log.Errorf("Couldn't purge trash %v", err)
+	}
+
+	names, err := h.Store.GetTrashNames()
+	if err != nil {
+		http.Error(w, "Couldn't read trash", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write([]byte(strings.Join(names, "\n")))
+	if err != nil {
+		log.Errorf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) RestoreTrekking(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Restoring trekking with name %s", name)
+
+	// anything past the retention window can't be restored, even if it wasn't purged yet
+	if err := h.purgeTrash(); err != nil {
+		http.Error(w, "Failed to restore trekking", http.StatusInternalServerError)
+		return
+	}
+
+	trekking, err := h.Store.GetTrashedTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	if err := h.authorize(r, trekking); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	if err := h.Store.RestoreTrekking(name); err != nil {
+		writeError(w, err, "Failed to restore trekking")
+		return
+	}
+
+	_, err = w.Write([]byte("Restored succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+// PurgeTrashPeriodically purges the trash until the context is done.
+func (h *Handler) PurgeTrashPeriodically(ctx context.Context) {
+	interval := h.Retention / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	} else if interval > time.Hour {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.purgeTrash(); err != nil {
+			log.Errorf("Couldn't purge trash %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+)
+
+func (h *Handler) GetMode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting draw mode of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	setETag(w, trekking)
+
+	_, err = w.Write([]byte(trekking.Mode.String()))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) SetMode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	mode, err := lootjestrekken.ParseDrawMode(vars["mode"])
+	if trekkingname == "" || err != nil {
+		http.Error(w, "Bad request, expected one of cycle, derangement or no-2-cycles", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Setting draw mode of trekking %s to %s", trekkingname, mode)
+
+	ok := h.modify(w, r, trekkingname, "Failed to update trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		trekking.Mode = mode
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err = w.Write([]byte("Updated succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
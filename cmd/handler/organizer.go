@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"strings"
+)
+
+// OwnerName is the name of the organizer that created a trekking.
+const OwnerName = "owner"
+
+// credential returns the organizer secret of a request, given either as a bearer token or as the
+// secret query parameter so that plain links keep working.
+func credential(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return r.URL.Query().Get("secret")
+}
+
+// authorize checks that the request comes from an organizer of the trekking. If it doesn't, it
+// returns a 401 error when no secret was given and a 403 error when the secret is wrong.
+// Trekkingen that were created before organizers existed have none and stay open to everyone.
+func (h *Handler) authorize(r *http.Request, trekking lootjestrekken.Trekking) error {
+	_, err := h.organizer(r, trekking)
+	return err
+}
+
+// organizer is like authorize, but also returns the name of the organizer. It is empty for
+// trekkingen without organizers.
+func (h *Handler) organizer(r *http.Request, trekking lootjestrekken.Trekking) (string, error) {
+	if len(trekking.Organizers) == 0 {
+		return "", nil
+	}
+
+	secret := credential(r)
+	if secret == "" {
+		return "", newHTTPError(http.StatusUnauthorized, "This requires an organizer secret")
+	}
+
+	organizer, ok := trekking.Organizer(secret)
+	if !ok {
+		return "", newHTTPError(http.StatusForbidden, "This organizer secret is not valid for this trekking")
+	}
+
+	log.Debugf("Authorized organizer %s of trekking %s", organizer, trekking.Name)
+	return organizer, nil
+}
+
+// owner checks that the request comes from the owner of the trekking, who alone may change the
+// secrets of organizers. Trekkingen without an owner leave that to every organizer.
+func (h *Handler) owner(r *http.Request, trekking lootjestrekken.Trekking) error {
+	organizer, err := h.organizer(r, trekking)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range trekking.Organizers {
+		if i.Name == OwnerName && organizer != OwnerName {
+			return newHTTPError(http.StatusForbidden, "Only the owner of this trekking can do this")
+		}
+	}
+	return nil
+}
+
+// claim checks that the request may add an organizer to the trekking. For a trekking without
+// organizers, from before they existed, imported or written by hand, that takes the admin secret,
+// otherwise whoever comes first would lock out everyone else.
+func (h *Handler) claim(r *http.Request, trekking lootjestrekken.Trekking) error {
+	if len(trekking.Organizers) > 0 {
+		return h.authorize(r, trekking)
+	}
+
+	if h.AdminSecret == "" {
+		return newHTTPError(http.StatusForbidden, "This trekking has no organizers yet, the first one can only be added with the admin secret, start the server with one")
+	}
+	return h.admin(r)
+}
+
+func (h *Handler) GetOrganizers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting organizers of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	if err := h.authorize(r, trekking); err != nil {
+		writeError(w, err, "")
+		return
+	}
+
+	organizers := make([]string, 0, len(trekking.Organizers))
+	for _, i := range trekking.Organizers {
+		organizers = append(organizers, i.Name)
+	}
+
+	_, err = w.Write([]byte(strings.Join(organizers, "\n")))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) AddOrganizer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	organizer := vars["organizer"]
+	if trekkingname == "" || organizer == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Adding organizer %s to trekking %s", organizer, trekkingname)
+
+	var secret string
+	ok := h.modify(w, r, trekkingname, "Failed to add organizer to trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.claim(r, *trekking); err != nil {
+			return err
+		}
+
+		var err error
+		secret, err = trekking.AddOrganizer(organizer)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte(fmt.Sprintf("Added succesfully. The organizer secret of %s, keep it secret: %s", organizer, secret)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) RotateOrganizer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	organizer := vars["organizer"]
+	if trekkingname == "" || organizer == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Giving organizer %s of trekking %s a new secret", organizer, trekkingname)
+
+	var secret string
+	ok := h.modify(w, r, trekkingname, "Failed to give organizer a new secret", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.owner(r, *trekking); err != nil {
+			return err
+		}
+
+		var err error
+		secret, err = trekking.RotateOrganizer(organizer)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte(fmt.Sprintf("The new organizer secret of %s, keep it secret: %s", organizer, secret)))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) RemoveOrganizer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	organizer := vars["organizer"]
+	if trekkingname == "" || organizer == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Removing organizer %s from trekking %s", organizer, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to remove organizer from trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.owner(r, *trekking); err != nil {
+			return err
+		}
+
+		if organizer == OwnerName {
+			return newHTTPError(http.StatusConflict, "Can't remove the owner")
+		}
+
+		if len(trekking.Organizers) == 1 && trekking.Organizers[0].Name == organizer {
+			return newHTTPError(http.StatusConflict, "Can't remove the last organizer")
+		}
+
+		if !trekking.RemoveOrganizer(organizer) {
+			return newHTTPError(http.StatusNotFound, "Couldn't find organizer")
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Removed succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+)
+
+// RenamePerson changes the name of a person, for example to fix a typo. Their id, personal link and
+// draw stay the same.
+func (h *Handler) RenamePerson(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	personname := vars["name"]
+	newname := vars["new-name"]
+	if trekkingname == "" || personname == "" || newname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Renaming person %s in trekking %s to %s", personname, trekkingname, newname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to rename person", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		return trekking.RenamePerson(personname, newname)
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Renamed succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) SetEmail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	personname := vars["name"]
+	email := vars["email"]
+	if trekkingname == "" || personname == "" || email == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Setting email of person %s in trekking %s", personname, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to update person", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		return trekking.SetEmail(personname, email)
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Updated succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) SetAttribute(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	personname := vars["name"]
+	key := vars["key"]
+	if trekkingname == "" || personname == "" || key == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Setting attribute %s of person %s in trekking %s", key, personname, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to update person", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.authorize(r, *trekking); err != nil {
+			return err
+		}
+
+		return trekking.SetAttribute(personname, key, vars["value"])
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Updated succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"strings"
+)
+
+func (h *Handler) GetExclusions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting exclusions of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	setETag(w, trekking)
+
+	exclusions := make([]string, 0, len(trekking.Exclusions))
+	for _, e := range trekking.Exclusions {
+		exclusions = append(exclusions, fmt.Sprintf("%s - %s", trekking.DisplayName(e.A), trekking.DisplayName(e.B)))
+	}
+
+	_, err = w.Write([]byte(strings.Join(exclusions, "\n")))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) AddExclusion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	a := vars["a"]
+	b := vars["b"]
+	if trekkingname == "" || a == "" || b == "" || a == b {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Adding exclusion between %s and %s to trekking %s", a, b, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to add exclusion to trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		trekking.AddExclusion(a, b)
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Added succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) RemoveExclusion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	a := vars["a"]
+	b := vars["b"]
+	if trekkingname == "" || a == "" || b == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Removing exclusion between %s and %s from trekking %s", a, b, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to remove exclusion from trekking", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		if !trekking.RemoveExclusion(a, b) {
+			return newHTTPError(http.StatusNotFound, "Couldn't find exclusion")
+		}
+
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Removed succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) GetHouseholds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["trekking-name"]
+	if name == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("getting households of trekking %s", name)
+
+	trekking, err := h.Store.GetTrekking(name)
+	if err != nil {
+		writeError(w, err, "Couldn't read trekking")
+		return
+	}
+
+	setETag(w, trekking)
+
+	households := make([]string, 0, len(trekking.Households))
+	for _, i := range trekking.Households {
+		members := make([]string, 0, len(i.Members))
+		for _, m := range i.Members {
+			members = append(members, trekking.DisplayName(m))
+		}
+		households = append(households, fmt.Sprintf("%s: %s", i.Name, strings.Join(members, ", ")))
+	}
+
+	_, err = w.Write([]byte(strings.Join(households, "\n")))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) AddToHousehold(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	household := vars["household"]
+	personname := vars["name"]
+	if trekkingname == "" || household == "" || personname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Adding person %s to household %s in trekking %s", personname, household, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to add person to household", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		trekking.AddToHousehold(household, personname)
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Added succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
+
+func (h *Handler) RemoveFromHousehold(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trekkingname := vars["trekking-name"]
+	household := vars["household"]
+	personname := vars["name"]
+	if trekkingname == "" || household == "" || personname == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("Removing person %s from household %s in trekking %s", personname, household, trekkingname)
+
+	ok := h.modify(w, r, trekkingname, "Failed to remove person from household", func(trekking *lootjestrekken.Trekking) error {
+		if err := h.setup(r, *trekking); err != nil {
+			return err
+		}
+
+		if !trekking.RemoveFromHousehold(household, personname) {
+			return newHTTPError(http.StatusNotFound, "Couldn't find person in household")
+		}
+
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	_, err := w.Write([]byte("Removed succesfully"))
+	if err != nil {
+		log.Printf("Couldn't write %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"lootjestrekken/cmd/store"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/http"
+	"strings"
+)
+
+func etag(version uint64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// setETag tells the client which version of the trekking it got, so it can send it back in an
+// If-Match header when it changes the trekking.
+func setETag(w http.ResponseWriter, trekking lootjestrekken.Trekking) {
+	w.Header().Set("ETag", etag(trekking.Version))
+}
+
+// matches checks the If-Match header of a request against the version of the trekking. If the
+// trekking changed since the client read it, it returns a 412 error.
+func matches(r *http.Request, trekking lootjestrekken.Trekking) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	for _, i := range strings.Split(header, ",") {
+		i = strings.TrimPrefix(strings.TrimSpace(i), "W/")
+		if i == "*" || i == etag(trekking.Version) {
+			return nil
+		}
+	}
+
+	return newHTTPError(http.StatusPreconditionFailed, "This trekking was changed since you last saw it")
+}
+
+// checkChange checks that the request may change the trekking and that it didn't change since the
+// client read it, for store calls that run it in their own transaction like Store.DeleteTrekking.
+func (h *Handler) checkChange(r *http.Request) func(trekking lootjestrekken.Trekking) error {
+	return func(trekking lootjestrekken.Trekking) error {
+		if err := h.authorize(r, trekking); err != nil {
+			return err
+		}
+		return matches(r, trekking)
+	}
+}
+
+// modify checks and changes a trekking in a single store transaction, so nobody can change it
+// between the checks and the change. If change or the store fails it answers the error, with
+// failmsg for errors that don't say how to answer them, and returns false.
+func (h *Handler) modify(w http.ResponseWriter, r *http.Request, name, failmsg string, change func(trekking *lootjestrekken.Trekking) error) bool {
+	return h.change(h.Store.Modify, w, r, name, failmsg, change)
+}
+
+// addPeople is like modify for changes that only add people. When the store is a store.Appender,
+// change gets the trekking without its people, so adding someone doesn't read everyone else.
+func (h *Handler) addPeople(w http.ResponseWriter, r *http.Request, name, failmsg string, change func(trekking *lootjestrekken.Trekking) error) bool {
+	if appender, ok := h.Store.(store.Appender); ok {
+		return h.change(appender.Append, w, r, name, failmsg, change)
+	}
+	return h.modify(w, r, name, failmsg, change)
+}
+
+func (h *Handler) change(apply func(name string, change func(trekking *lootjestrekken.Trekking) error) error, w http.ResponseWriter, r *http.Request, name, failmsg string, change func(trekking *lootjestrekken.Trekking) error) bool {
+	var version uint64
+	err := apply(name, func(trekking *lootjestrekken.Trekking) error {
+		if err := matches(r, *trekking); err != nil {
+			return err
+		}
+
+		if err := change(trekking); err != nil {
+			return err
+		}
+
+		version = trekking.Version + 1
+		return nil
+	})
+	if err != nil {
+		writeError(w, err, failmsg)
+		return false
+	}
+
+	w.Header().Set("ETag", etag(version))
+	return true
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -16,7 +19,7 @@ import (
 
 func TestIntegration(t *testing.T) {
 	log.Info("Running in memory test")
-	IntegrationHelper(t, "inmemory", "")
+	IntegrationHelper(t, 12345, "memory://")
 
 	log.Info("Running db test")
 	d := os.TempDir()
@@ -25,23 +28,33 @@ func TestIntegration(t *testing.T) {
 	assert.NoError(t, err)
 	err = os.Mkdir(p, os.ModePerm)
 	assert.NoError(t, err)
-	IntegrationHelper(t, "db", p)
+	IntegrationHelper(t, 12445, "bolt://"+p+"/lootjestrekken.db")
 	err = os.RemoveAll(p)
 	assert.NoError(t, err)
+
+	log.Info("Running sqlite test")
+	err = os.Mkdir(p, os.ModePerm)
+	assert.NoError(t, err)
+	IntegrationHelper(t, 12448, "sqlite://"+p+"/lootjestrekken.sqlite")
+	err = os.RemoveAll(p)
+	assert.NoError(t, err)
+
+	log.Info("Running redis test")
+	IntegrationHelper(t, 12453, "redis://"+miniredis.RunT(t).Addr())
 }
 
-func IntegrationHelper(t *testing.T, storetype, dbloc string) {
+func IntegrationHelper(t *testing.T, port int, storeurl string) {
 	ctx, cancel := context.WithCancel(context.Background())
-	go runServer(ctx, "0.0.0.0", 12345, storetype, dbloc)
+	go runServer(ctx, "0.0.0.0", port, storeurl, "crypto", 0, time.Hour, "")
 	defer cancel()
 
 	time.Sleep(500 * time.Millisecond)
 
-	res, err := http.Get("http://localhost:12345/")
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
-	res, err = http.Get("http://localhost:12345/t")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
@@ -51,11 +64,20 @@ func IntegrationHelper(t *testing.T, storetype, dbloc string) {
 	assert.Equal(t, n, 0)
 	assert.Equal(t, arr[:n], []byte(""))
 
-	res, err = http.Get("http://localhost:12345/t/test/add")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/add", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	secret := readSecret(t, res)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathaan/add", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/state/open?secret=%s", port, secret))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
-	res, err = http.Get("http://localhost:12345/t")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
@@ -65,7 +87,7 @@ func IntegrationHelper(t *testing.T, storetype, dbloc string) {
 	assert.Greater(t, n, 0)
 	assert.Equal(t, arr[:n], []byte("test"))
 
-	res, err = http.Get("http://localhost:12345/t/test/people")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
@@ -75,15 +97,15 @@ func IntegrationHelper(t *testing.T, storetype, dbloc string) {
 	assert.Equal(t, n, 0)
 	assert.Equal(t, arr[:n], []byte(""))
 
-	res, err = http.Get("http://localhost:12345/t/test/people/jonathaan/add")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathaan/add", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
-	res, err = http.Get("http://localhost:12345/t/test/people/jonathan/add")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathan/add", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
-	res, err = http.Get("http://localhost:12345/t/test/people")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
@@ -93,11 +115,53 @@ func IntegrationHelper(t *testing.T, storetype, dbloc string) {
 	assert.Greater(t, n, 0)
 	assert.Equal(t, arr[:n], []byte("jonathaan\njonathan"))
 
-	res, err = http.Get("http://localhost:12345/t/test/people/jonathaan/remove")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathaan/remove", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathaan/remove?secret=wrong", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathaan/remove?secret=%s", port, secret))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
-	res, err = http.Get("http://localhost:12345/t/test/people")
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathaan/remove?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	// a second jonathan gets their own id
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathan/add", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	id := strings.Split(readSecret(t, res), "/")[4]
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jonathan/remove?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/%s/rename/jan?secret=%s", port, id, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "jonathan\njan", string(body))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/jan/remove?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/unknown/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people", port))
 	assert.NoError(t, err)
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 
@@ -106,8 +170,371 @@ func IntegrationHelper(t *testing.T, storetype, dbloc string) {
 	assert.Equal(t, err, io.EOF)
 	assert.Greater(t, n, 0)
 	assert.Equal(t, arr[:n], []byte("jonathan"))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	version := res.Header.Get("ETag")
+	assert.NotEqual(t, "", version)
+
+	res, err = getWithHeader(fmt.Sprintf("http://localhost:%d/t/test/mode/derangement?secret=%s", port, secret), "If-Match", "\"12345\"")
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+
+	res, err = getWithHeader(fmt.Sprintf("http://localhost:%d/t/test/mode/cycle?secret=%s", port, secret), "If-Match", version)
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.NotEqual(t, version, res.Header.Get("ETag"))
+
+	res, err = getWithHeader(fmt.Sprintf("http://localhost:%d/t/test/mode/cycle?secret=%s", port, secret), "If-Match", version)
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/exclusions/jonathan/piet/add?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/households/thuis/jonathan/add?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/households/thuis/marie/add?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/exclusions", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	arr = make([]byte, 1024)
+	n, err = res.Body.Read(arr)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, arr[:n], []byte("jonathan - piet"))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/households", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	arr = make([]byte, 1024)
+	n, err = res.Body.Read(arr)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, arr[:n], []byte("thuis: jonathan, marie"))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/exclusions/piet/jonathan/remove?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/exclusions/piet/jonathan/remove?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/mode/derangement?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/mode/chain?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusBadRequest)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/mode", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	arr = make([]byte, 1024)
+	n, err = res.Body.Read(arr)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, arr[:n], []byte("derangement"))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers/piet/add?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	pietsecret := readSecret(t, res)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers?secret=%s", port, pietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	arr = make([]byte, 1024)
+	n, err = res.Body.Read(arr)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, arr[:n], []byte("owner\npiet"))
+
+	// a co-organizer can't take over the owner
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers/owner/add?secret=%s", port, pietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers/owner/rotate?secret=%s", port, pietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers/owner/remove?secret=%s", port, pietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers/piet/rotate?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	oldpietsecret := pietsecret
+	pietsecret = readSecret(t, res)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers?secret=%s", port, oldpietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/organizers/piet/remove?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/raw?secret=%s", port, pietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/history", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/history?secret=%s", port, pietsecret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/history?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/state/closed?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/klaas/add", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/commitment", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/commit?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/commitment", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/piet/add?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/mode/derangement?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/reveal?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/clone/test2", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/clone/test2?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/clone/test2?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test2/rename/test3?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	arr = make([]byte, 1024)
+	n, err = res.Body.Read(arr)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, arr[:n], []byte("jonathan"))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/people/jonathan/link?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/delete?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/trash", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	arr = make([]byte, 1024)
+	n, err = res.Body.Read(arr)
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, arr[:n], []byte("test3"))
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/trash/test3/restore", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/trash/test3/restore?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/trash/test3/restore?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test2/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusNotFound)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/delete", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+	res, err = getWithHeader(fmt.Sprintf("http://localhost:%d/t/test3/delete?secret=%s", port, secret), "If-Match", "\"12345\"")
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+
+	res, err = getWithHeader(fmt.Sprintf("http://localhost:%d/t/test3/rename/test4?secret=%s", port, secret), "If-Match", "\"12345\"")
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusPreconditionFailed)
+
+	// deleting a trekking with the name of one in the trash would lose that one
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/clone/test4?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test4/delete?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test3/rename/test4?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test4/delete?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusConflict)
+}
+
+
+// getWithHeader does a GET request with an extra header.
+func getWithHeader(url, key, value string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(key, value)
+	return http.DefaultClient.Do(req)
+}
+
+func TestConcurrentSignups(t *testing.T) {
+	log.Info("Running in memory test")
+	ConcurrentSignupsHelper(t, 12446, "memory://")
+
+	log.Info("Running db test")
+	p := os.TempDir() + "/LootjesTrekkenTestConcurrentSignups"
+	err := os.RemoveAll(p)
+	assert.NoError(t, err)
+	err = os.Mkdir(p, os.ModePerm)
+	assert.NoError(t, err)
+	ConcurrentSignupsHelper(t, 12447, "bolt://"+p+"/lootjestrekken.db")
+	err = os.RemoveAll(p)
+	assert.NoError(t, err)
+
+	log.Info("Running sqlite test")
+	err = os.Mkdir(p, os.ModePerm)
+	assert.NoError(t, err)
+	ConcurrentSignupsHelper(t, 12449, "sqlite://"+p+"/lootjestrekken.sqlite")
+	err = os.RemoveAll(p)
+	assert.NoError(t, err)
+
+	log.Info("Running redis test")
+	ConcurrentSignupsHelper(t, 12454, "redis://"+miniredis.RunT(t).Addr())
 }
 
+// ConcurrentSignupsHelper signs up many people at the same time. Every sign-up runs in its own
+// transaction, so none are refused and all of them end up in the trekking.
+func ConcurrentSignupsHelper(t *testing.T, port int, storeurl string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go runServer(ctx, "0.0.0.0", port, storeurl, "crypto", 0, time.Hour, "")
+	defer cancel()
+
+	time.Sleep(500 * time.Millisecond)
+
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/t/test/add", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	secret := readSecret(t, res)
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/state/open?secret=%s", port, secret))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	num := 50
+	accepted := make(chan string, num)
+
+	var wg sync.WaitGroup
+	wg.Add(num)
+	for i := 0; i < num; i++ {
+		name := fmt.Sprint("person", i)
+		go func() {
+			defer wg.Done()
+
+			res, err := http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/%s/add", port, name))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			if assert.Equal(t, http.StatusOK, res.StatusCode) {
+				accepted <- name
+			}
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+
+	expected := make([]string, 0, num)
+	for i := range accepted {
+		expected = append(expected, i)
+	}
+
+	res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people", port))
+	assert.NoError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	people := strings.Split(string(body), "\n")
+	assert.Len(t, expected, num)
+	assert.ElementsMatch(t, expected, people)
+}
+
+// readSecret reads the secret or personal link at the end of a response.
+func readSecret(t *testing.T, res *http.Response) string {
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+
+	parts := strings.SplitN(string(body), ": ", 2)
+	if assert.Equal(t, 2, len(parts)) {
+		return parts[1]
+	}
+	return ""
+}
 
 func TestSame(t *testing.T) {
 	num := 100
@@ -121,35 +548,68 @@ func TestSame(t *testing.T) {
 			port := 12340 + i
 
 			ctx, cancel := context.WithCancel(context.Background())
-			go runServer(ctx, "0.0.0.0", port, "inmemory", "")
+			go runServer(ctx, "0.0.0.0", port, "memory://", "crypto", 0, time.Hour, "")
 			time.Sleep(1 * time.Second)
 
 			res, err := http.Get(fmt.Sprintf("http://localhost:%d/t/test/add", port))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
+			secret := readSecret(t, res)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/state/open?secret=%s", port, secret))
+			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusOK)
 
 			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/a/add", port))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
+			linkA := readSecret(t, res)
 
 			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/b/add", port))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
+			linkB := readSecret(t, res)
 
 			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/c/add", port))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
+			linkC := readSecret(t, res)
 
 			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/d/add", port))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
+			linkD := readSecret(t, res)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/trek?secret=%s", port, secret))
+			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusConflict)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/state/closed?secret=%s", port, secret))
+			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusOK)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/trek?secret=%s", port, secret))
+			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusOK)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/trek?secret=%s", port, secret))
+			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusConflict)
 
-			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/trek", port))
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/redraw?secret=%s&reason=test", port, secret))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
 
 			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/a/getrokken", port))
 			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, strings.SplitN(linkB, "?", 2)[0]+"?"+strings.SplitN(linkA, "?", 2)[1]))
+			assert.NoError(t, err)
+			assert.Equal(t, res.StatusCode, http.StatusForbidden)
+
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, linkA))
+			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
 			arr := make([]byte, 1024)
 			n, err := res.Body.Read(arr)
@@ -158,7 +618,7 @@ func TestSame(t *testing.T) {
 			assert.NotEqual(t, arr[n-1:n], []byte("a"))
 			assert.True(t, reflect.DeepEqual(arr[n-1:n], []byte("b")) || reflect.DeepEqual(arr[n-1:n], []byte("c")) || reflect.DeepEqual(arr[n-1:n], []byte("d")))
 
-			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/b/getrokken", port))
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, linkB))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
 			arr = make([]byte, 1024)
@@ -168,7 +628,7 @@ func TestSame(t *testing.T) {
 			assert.NotEqual(t, arr[n-1:n], []byte("b"))
 			assert.True(t, reflect.DeepEqual(arr[n-1:n], []byte("a")) || reflect.DeepEqual(arr[n-1:n], []byte("c")) || reflect.DeepEqual(arr[n-1:n], []byte("d")))
 
-			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/c/getrokken", port))
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, linkC))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
 			arr = make([]byte, 1024)
@@ -178,7 +638,7 @@ func TestSame(t *testing.T) {
 			assert.NotEqual(t, arr[n-1:n], []byte("c"))
 			assert.True(t, reflect.DeepEqual(arr[n-1:n], []byte("a")) || reflect.DeepEqual(arr[n-1:n], []byte("b")) || reflect.DeepEqual(arr[n-1:n], []byte("d")))
 
-			res, err = http.Get(fmt.Sprintf("http://localhost:%d/t/test/people/d/getrokken", port))
+			res, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, linkD))
 			assert.NoError(t, err)
 			assert.Equal(t, res.StatusCode, http.StatusOK)
 			arr = make([]byte, 1024)
@@ -195,3 +655,83 @@ func TestSame(t *testing.T) {
 
 	wg.Wait()
 }
+
+// TestAdmin moves the trekkingen of a bolt store to an in memory store through the admin endpoints.
+func TestAdmin(t *testing.T) {
+	p := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runServer(ctx, "0.0.0.0", 12450, "bolt://"+p+"/lootjestrekken.db", "crypto", 0, time.Hour, "admin")
+	go runServer(ctx, "0.0.0.0", 12451, "memory://", "crypto", 0, time.Hour, "admin")
+	go runServer(ctx, "0.0.0.0", 12452, "memory://", "crypto", 0, time.Hour, "")
+
+	time.Sleep(500 * time.Millisecond)
+
+	res, err := http.Get("http://localhost:12450/t/test/add")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	res, err = http.Get("http://localhost:12450/admin/export")
+	assert.NoError(t, err)
+	assert.Equal(t, 401, res.StatusCode)
+	res, err = http.Get("http://localhost:12450/admin/export?secret=wrong")
+	assert.NoError(t, err)
+	assert.Equal(t, 403, res.StatusCode)
+	res, err = http.Get("http://localhost:12452/admin/export?secret=")
+	assert.NoError(t, err)
+	assert.Equal(t, 404, res.StatusCode)
+
+	res, err = http.Get("http://localhost:12450/admin/backup?secret=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, body)
+
+	// an in memory store backs up as an export
+	res, err = http.Get("http://localhost:12451/admin/backup?secret=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	body, err = ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"Trekkingen"`)
+
+	res, err = http.Get("http://localhost:12450/admin/export?secret=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	export, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+
+	res, err = http.Post("http://localhost:12451/admin/import?secret=admin", "application/json", strings.NewReader(string(export)))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res, err = http.Post("http://localhost:12451/admin/import?secret=admin", "application/json", strings.NewReader(string(export)))
+	assert.NoError(t, err)
+	assert.Equal(t, 409, res.StatusCode)
+	res, err = http.Post("http://localhost:12451/admin/import?secret=admin", "application/json", strings.NewReader("nonsense"))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+
+	res, err = http.Get("http://localhost:12451/t")
+	assert.NoError(t, err)
+	body, err = ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", string(body))
+
+	// a trekking without organizers can't be claimed by whoever comes first
+	res, err = http.Post("http://localhost:12451/admin/import?secret=admin", "application/json", strings.NewReader(`{"Version": 1, "Trekkingen": [{"Name": "oud"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res, err = http.Get("http://localhost:12451/t/oud/organizers/owner/add")
+	assert.NoError(t, err)
+	assert.Equal(t, 401, res.StatusCode)
+	res, err = http.Get("http://localhost:12451/t/oud/organizers/owner/add?secret=wrong")
+	assert.NoError(t, err)
+	assert.Equal(t, 403, res.StatusCode)
+	res, err = http.Get("http://localhost:12451/t/oud/organizers/owner/add?secret=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res, err = http.Get("http://localhost:12451/t/oud/organizers/piet/add?secret=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 403, res.StatusCode)
+}
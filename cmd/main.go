@@ -7,8 +7,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	. "lootjestrekken/cmd/handler"
 	"lootjestrekken/cmd/store"
+	"lootjestrekken/pkg/lootjestrekken"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -17,8 +20,16 @@ import (
 var (
 	address = flag.String("address", "0.0.0.0", "Address to serve on")
 	port = flag.Int("port", 8080, "Port to serve on")
-	storetype = flag.String("store", "inmemory", "store type: [inmemory, db]")
-	dbloc = flag.String("location", "./data", "db location")
+	storeurl = flag.String("store", "memory://", "store url, like memory://, memory:///data/lootjestrekken.json?interval=1m, bolt:///data/lootjestrekken.db?timeout=1s&keyfile=/run/secrets/lootjes.key, sqlite:///data/lootjestrekken.sqlite, dir:///data/trekkingen?format=yaml or redis://localhost:6379/0?prefix=lootjestrekken:")
+	randomtype = flag.String("random", "crypto", "randomness used for draws: [crypto, seeded]")
+	seed = flag.Int64("seed", 0, "seed for the seeded randomness, to replay draws")
+	adminsecret = flag.String("admin-secret", os.Getenv("ADMIN_SECRET"), "secret for the /admin endpoints, they are disabled without it (default $ADMIN_SECRET)")
+	backupfile = flag.String("backup", "", "write a snapshot of the store to this file and exit")
+	exportfile = flag.String("export", "", "write all trekkingen of the store to this json file and exit")
+	importfile = flag.String("import", "", "add the trekkingen of this json export to the store and exit")
+	check = flag.Bool("check", false, "show the trekkingen of the store that can't be read, like files edited by hand, and exit")
+	migrateDryRun = flag.Bool("migrate-dry-run", false, "show what opening the store would migrate, without changing it, and exit")
+	retention = flag.Duration("retention", 30*24*time.Hour, "how long deleted trekkingen can be restored")
 )
 
 func Home(w http.ResponseWriter, r *http.Request) {
@@ -34,13 +45,63 @@ pre {
 <pre>
 Welcome to LootjesTrekken!
 
-use /t                                           to list ongoing trekkingen
-use /t/{trekking-name}/add                       to start a new trekking with this name
-use /t/{trekking-name}/people                    to list people in a trekking
-use /t/{trekking-name}/people/{name}/add         to add a person to a trekking with this name
-use /t/{trekking-name}/people/{name}/remove      to remove a person from a trekking with this name
-use /t/{trekking-name}/trek                      to trek this trekking
-use /t/{trekking-name}/people/{name}/getrokken   to see who you have getrokken
+Creating a trekking gives you an organizer secret. Everything that changes a trekking or shows its draw
+needs it, as a "Authorization: Bearer {secret}" header or by adding ?secret={secret} to the link.
+Every person gets an id when they are added. Wherever a link has a {name}, the id works too, and is
+needed when several people have the same name.
+
+use /t                                                        to list ongoing trekkingen
+use /t/{trekking-name}/add                                    to start a new trekking with this name
+use /t/{trekking-name}/delete                                 to move a trekking to the trash
+use /trash                                                    to list deleted trekkingen that can still be restored
+use /trash/{trekking-name}/restore                            to restore a deleted trekking
+use /t/{trekking-name}/rename/{new-name}                      to rename a trekking
+use /t/{trekking-name}/clone/{new-name}                       to start a new trekking with the people and settings of this one
+use /t/{trekking-name}/people                                 to list people in a trekking
+use /t/{trekking-name}/people/{name}/add                      to add a person to a trekking with this name, this gives you your personal link
+use /t/{trekking-name}/people/{name}/remove                   to remove a person from a trekking with this name
+use /t/{trekking-name}/trek                                   to trek this trekking once sign-up is closed
+use /t/{trekking-name}/people/{name}/getrokken?token={token}  to see who you have getrokken, using your personal link
+use /t/{trekking-name}/people/{name}/link                     to give a person a new personal link
+use /t/{trekking-name}/people/{name}/rename/{new-name}        to change the name of a person, they keep their id
+use /t/{trekking-name}/people/{name}/email/{email}            to set the email address of a person
+use /t/{trekking-name}/people/{name}/attributes/{key}/{value} to set some other information about a person
+
+use /t/{trekking-name}/state                                  to see where a trekking is: draft, open, closed, drawn, revealed or archived
+use /t/{trekking-name}/state/{state}                          to open sign-up (open), close it (closed), or mark the draw revealed or archived
+use /t/{trekking-name}/redraw?reason={reason}                 to draw a drawn trekking again, this is recorded with your reason
+
+use /t/{trekking-name}/exclusions                             to list pairs that may not draw each other
+use /t/{trekking-name}/exclusions/{name}/{other}/add          to forbid two people from drawing each other
+use /t/{trekking-name}/exclusions/{name}/{other}/remove       to allow two people to draw each other again
+use /t/{trekking-name}/households                             to list households
+use /t/{trekking-name}/households/{household}/{name}/add      to add a person to a household
+use /t/{trekking-name}/households/{household}/{name}/remove   to remove a person from a household
+
+use /t/{trekking-name}/history                                to list earlier draws this trekking avoids repeating
+use /t/{trekking-name}/history/add                            to add an earlier draw, posted as json {"People": [...], "PeopleMapping": [...], "At": "2024-12-05T00:00:00Z"}, the date is optional
+use /t/{trekking-name}/history/years/{years}                  to only avoid the draws of the last {years} years (0 for all)
+use /t/{trekking-name}/previous/{previous}/add                to avoid repeating the draw of an earlier trekking
+use /t/{trekking-name}/previous/{previous}/remove             to stop avoiding the draw of an earlier trekking
+
+use /t/{trekking-name}/mode                                   to see how this trekking is drawn
+use /t/{trekking-name}/mode/{mode}                            to draw one big cycle (cycle), any derangement (derangement)
+                                                              or any derangement without swaps (no-2-cycles)
+
+use /t/{trekking-name}/commit                                 to make the draw auditable, this fixes the people and rules and publishes a commitment
+use /t/{trekking-name}/commitment                             to see the commitment: the sha256 of the seed and the inputs of the draw as json
+use /t/{trekking-name}/reveal                                 to reveal the seed and the inputs after the draw, so anyone can verify it
+
+use /t/{trekking-name}/organizers                             to list the organizers of a trekking
+use /t/{trekking-name}/organizers/{organizer}/add             to add a co-organizer, this gives them their own secret, the first organizer of a trekking without any takes the admin secret
+use /t/{trekking-name}/organizers/{organizer}/rotate          to give an organizer a new secret, only the owner can do this
+use /t/{trekking-name}/organizers/{organizer}/remove          to remove a co-organizer, only the owner can do this
+
+The admin endpoints need the admin secret the server was started with, in the same way as an organizer secret.
+
+use /admin/backup                                             to download a consistent snapshot of a bolt or memory store
+use /admin/export                                             to download all trekkingen as json, for any store
+use /admin/import                                             to add the trekkingen of a json export, posted as the body
 
 </pre>
 </body>
@@ -70,35 +131,50 @@ func init() {
 	}
 }
 
-func getStore(storetype, location string) (store.Store, error) {
-	switch storetype {
+func getRandomness(randomtype string, seed int64) (lootjestrekken.Randomness, error) {
+	switch randomtype {
+	case "crypto":
+		log.Infof("Using cryptographically secure randomness")
+		return lootjestrekken.CryptoRandomness{}, nil
+	case "seeded":
+		log.Warnf("Using seeded randomness with seed %d, draws are predictable", seed)
+		return lootjestrekken.NewSeededRandomness(seed), nil
 	default:
-		log.Error("Unexpected value for store type: %s", storetype)
-		fallthrough
-	case "inmemory":
-		log.Infof("Using in memory data store")
-		return store.NewInMemoryStore(), nil
-	case "db":
-		log.Infof("Using persistent data store at %s", location)
-		return store.NewDbStore(location)
+		return nil, fmt.Errorf("unexpected value for randomness: %s", randomtype)
 	}
 }
 
-func runServer(ctx context.Context, address string, port int, storetype, dbloc string) {
+func runServer(ctx context.Context, address string, port int, storeurl, randomtype string, seed int64, retention time.Duration, adminsecret string) {
 	r := mux.NewRouter()
-	s, err := getStore(storetype, dbloc)
+	s, err := store.Open(storeurl)
 	if err != nil {
 		log.Fatalf("Couldn't get db connection: %v", err)
 	}
+	log.Infof("Using store %s", storeurl)
+
+	random, err := getRandomness(randomtype, seed)
+	if err != nil {
+		log.Fatalf("Couldn't get randomness: %v", err)
+	}
 
 	h := Handler{
-		Store: s,
+		Store:       s,
+		Randomness:  random,
+		Retention:   retention,
+		AdminSecret: adminsecret,
 	}
 
+	go h.PurgeTrashPeriodically(ctx)
+
 	r.StrictSlash(true)
 
 	r.HandleFunc("/", Home)
 	r.HandleFunc("/t", h.ListTrekkingen)
+	r.HandleFunc("/trash", h.GetTrash)
+	r.HandleFunc("/trash/{trekking-name}/restore", h.RestoreTrekking)
+	r.HandleFunc("/admin/backup", h.Backup)
+	r.HandleFunc("/admin/export", h.Export)
+	r.HandleFunc("/admin/import", h.Import)
 	r.HandleFunc("/t/{trekking-name}/add", h.NewTrekking)
 	r.HandleFunc("/t/{trekking-name}/raw", h.RawTrekking)
 	r.HandleFunc("/t/{trekking-name}/people", h.GetPeople)
@@ -107,6 +183,36 @@ func runServer(ctx context.Context, address string, port int, storetype, dbloc s
 	r.HandleFunc("/t/{trekking-name}/people/{name}/remove", h.RemovePerson)
 	r.HandleFunc("/t/{trekking-name}/trek", h.Trek)
 	r.HandleFunc("/t/{trekking-name}/people/{name}/getrokken", h.Getrokken)
+	r.HandleFunc("/t/{trekking-name}/exclusions", h.GetExclusions)
+	r.HandleFunc("/t/{trekking-name}/exclusions/{a}/{b}/add", h.AddExclusion)
+	r.HandleFunc("/t/{trekking-name}/exclusions/{a}/{b}/remove", h.RemoveExclusion)
+	r.HandleFunc("/t/{trekking-name}/households", h.GetHouseholds)
+	r.HandleFunc("/t/{trekking-name}/households/{household}/{name}/add", h.AddToHousehold)
+	r.HandleFunc("/t/{trekking-name}/households/{household}/{name}/remove", h.RemoveFromHousehold)
+	r.HandleFunc("/t/{trekking-name}/history", h.GetHistory)
+	r.HandleFunc("/t/{trekking-name}/history/add", h.AddHistory)
+	r.HandleFunc("/t/{trekking-name}/history/years/{years}", h.SetHistoryYears)
+	r.HandleFunc("/t/{trekking-name}/previous/{previous}/add", h.LinkPrevious)
+	r.HandleFunc("/t/{trekking-name}/previous/{previous}/remove", h.UnlinkPrevious)
+	r.HandleFunc("/t/{trekking-name}/mode", h.GetMode)
+	r.HandleFunc("/t/{trekking-name}/mode/{mode}", h.SetMode)
+	r.HandleFunc("/t/{trekking-name}/commit", h.Commit)
+	r.HandleFunc("/t/{trekking-name}/commitment", h.GetCommitment)
+	r.HandleFunc("/t/{trekking-name}/reveal", h.Reveal)
+	r.HandleFunc("/t/{trekking-name}/organizers", h.GetOrganizers)
+	r.HandleFunc("/t/{trekking-name}/organizers/{organizer}/add", h.AddOrganizer)
+	r.HandleFunc("/t/{trekking-name}/organizers/{organizer}/rotate", h.RotateOrganizer)
+	r.HandleFunc("/t/{trekking-name}/organizers/{organizer}/remove", h.RemoveOrganizer)
+	r.HandleFunc("/t/{trekking-name}/state", h.GetState)
+	r.HandleFunc("/t/{trekking-name}/state/{state}", h.SetState)
+	r.HandleFunc("/t/{trekking-name}/redraw", h.Redraw)
+	r.HandleFunc("/t/{trekking-name}/delete", h.DeleteTrekking)
+	r.HandleFunc("/t/{trekking-name}/rename/{new-name}", h.RenameTrekking)
+	r.HandleFunc("/t/{trekking-name}/clone/{new-name}", h.CloneTrekking)
+	r.HandleFunc("/t/{trekking-name}/people/{name}/link", h.IssueLink)
+	r.HandleFunc("/t/{trekking-name}/people/{name}/rename/{new-name}", h.RenamePerson)
+	r.HandleFunc("/t/{trekking-name}/people/{name}/email/{email}", h.SetEmail)
+	r.HandleFunc("/t/{trekking-name}/people/{name}/attributes/{key}/{value}", h.SetAttribute)
 
 	srv := &http.Server{
 		Handler: r,
@@ -133,11 +239,56 @@ func runServer(ctx context.Context, address string, port int, storetype, dbloc s
 			if err != nil {
 				log.Fatal(err)
 			}
+			if err := closeStore(s); err != nil {
+				log.Errorf("Couldn't close the store: %v", err)
+			}
+			return
 		}
 	}
 }
 
 func main() {
 	flag.Parse()
-	runServer(context.Background(), *address, *port, *storetype, *dbloc)
+	switch {
+	case *migrateDryRun:
+		if err := dryRunMigrations(*storeurl); err != nil {
+			log.Fatalf("Couldn't check migrations: %v", err)
+		}
+		return
+	case *check:
+		if err := checkStore(*storeurl); err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+		return
+	case *backupfile != "":
+		if err := backupStore(*storeurl, *backupfile); err != nil {
+			log.Fatalf("Couldn't back up the store: %v", err)
+		}
+		return
+	case *exportfile != "":
+		if err := exportStore(*storeurl, *exportfile); err != nil {
+			log.Fatalf("Couldn't export the store: %v", err)
+		}
+		return
+	case *importfile != "":
+		if err := importStore(*storeurl, *importfile); err != nil {
+			log.Fatalf("Couldn't import into the store: %v", err)
+		}
+		return
+	}
+	if *retention < 0 {
+		log.Fatalf("retention can't be negative: %s", *retention)
+	}
+
+	// stopping the server closes the store, which lets the memory store write its last snapshot
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("Stopping on %s", sig)
+		cancel()
+	}()
+
+	runServer(ctx, *address, *port, *storeurl, *randomtype, *seed, *retention, *adminsecret)
 }
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"lootjestrekken/pkg/lootjestrekken"
+)
+
+// ExportVersion is the version of the format Export writes.
+const ExportVersion = 1
+
+var ErrBackupNotSupported = errors.New("store doesn't support backups")
+var ErrInvalidExport = errors.New("invalid export")
+
+// Backuper is a store that can write a consistent copy of itself while it is in use.
+type Backuper interface {
+	Backup(w io.Writer) (int64, error)
+}
+
+// Backup writes a snapshot of the bolt database, which can be opened as a DbStore.
+func (i *DbStore) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := i.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Backup writes a snapshot of the store, if it supports that.
+func Backup(s Store, w io.Writer) (int64, error) {
+	b, ok := s.(Backuper)
+	if !ok {
+		return 0, ErrBackupNotSupported
+	}
+	return b.Backup(w)
+}
+
+// export is all data of a store, in a format that doesn't depend on the store.
+type export struct {
+	Version    int
+	Trekkingen []lootjestrekken.Trekking
+	Trash      []lootjestrekken.Trekking
+}
+
+// Export writes all trekkingen of a store, including those in the trash, as json. Import reads them
+// into any other store.
+func Export(s Store, w io.Writer) error {
+	e := export{Version: ExportVersion, Trekkingen: []lootjestrekken.Trekking{}, Trash: []lootjestrekken.Trekking{}}
+
+	names, err := s.GetTrekkingNames()
+	if err != nil {
+		return err
+	}
+	for _, i := range names {
+		trekking, err := s.GetTrekking(i)
+		if err != nil {
+			return fmt.Errorf("trekking %s: %w", i, err)
+		}
+		e.Trekkingen = append(e.Trekkingen, trekking)
+	}
+
+	names, err = s.GetTrashNames()
+	if err != nil {
+		return err
+	}
+	for _, i := range names {
+		trekking, err := s.GetTrashedTrekking(i)
+		if err != nil {
+			return fmt.Errorf("trashed trekking %s: %w", i, err)
+		}
+		e.Trash = append(e.Trash, trekking)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(e)
+}
+
+// Import adds the trekkingen written by Export to a store. It stops at the first trekking that
+// can't be added, for example because its name is already in use. Trekkingen in the trash are
+// trashed again, so the time they can still be restored starts over.
+func Import(s Store, r io.Reader) (int, error) {
+	var e export
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	if e.Version > ExportVersion {
+		return 0, fmt.Errorf("%w: it has version %d, this version supports up to %d", ErrInvalidExport, e.Version, ExportVersion)
+	}
+
+	count := 0
+	// the trash goes first, a trekking in the trash may have the name of one that isn't
+	for _, i := range e.Trash {
+		i.Restore()
+		if err := s.AddTrekking(i.Name, i); err != nil {
+			return count, fmt.Errorf("trashed trekking %s: %w", i.Name, err)
+		}
+		if err := s.DeleteTrekking(i.Name, nil); err != nil {
+			return count, fmt.Errorf("trashed trekking %s: %w", i.Name, err)
+		}
+		count++
+	}
+
+	for _, i := range e.Trekkingen {
+		if err := s.AddTrekking(i.Name, i); err != nil {
+			return count, fmt.Errorf("trekking %s: %w", i.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"lootjestrekken/pkg/lootjestrekken"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	trekking := lootjestrekken.Trekking{}
+	for _, i := range []string{"jan", "piet", "klaas"} {
+		_, err := trekking.AddPerson(i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, trekking.TrekWith(lootjestrekken.DefaultRandomness))
+
+	from := NewInMemoryStore()
+	assert.NoError(t, from.AddTrekking("a", trekking))
+	assert.NoError(t, from.AddTrekking("b", lootjestrekken.Trekking{}))
+	assert.NoError(t, from.DeleteTrekking("b", nil))
+	assert.NoError(t, from.AddTrekking("b", lootjestrekken.Trekking{}))
+
+	var export bytes.Buffer
+	assert.NoError(t, Export(from, &export))
+
+	to, err := NewDbStore(t.TempDir())
+	assert.NoError(t, err)
+	defer to.Db.Close()
+
+	count, err := Import(to, bytes.NewReader(export.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	imported, err := to.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, trekking.People, imported.People)
+	assert.Equal(t, trekking.PeopleMapping, imported.PeopleMapping)
+	_, err = to.GetTrashedTrekking("b")
+	assert.NoError(t, err)
+
+	// importing again is refused instead of overwriting trekkingen
+	_, err = Import(to, bytes.NewReader(export.Bytes()))
+	assert.True(t, errors.Is(err, ErrExists))
+
+	_, err = Import(to, strings.NewReader("{"))
+	assert.True(t, errors.Is(err, ErrInvalidExport))
+	_, err = Import(to, strings.NewReader(`{"Version": 1000}`))
+	assert.True(t, errors.Is(err, ErrInvalidExport))
+}
+
+func TestBackup(t *testing.T) {
+	sqlstore, err := NewSQLiteStore(t.TempDir())
+	assert.NoError(t, err)
+	_, err = Backup(sqlstore, &bytes.Buffer{})
+	assert.Equal(t, ErrBackupNotSupported, err)
+
+	s, err := NewDbStore(t.TempDir())
+	assert.NoError(t, err)
+	defer s.Db.Close()
+	assert.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+
+	// the store stays open while it is backed up
+	path := t.TempDir() + "/backup.db"
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	_, err = Backup(s, f)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	backup, err := OpenDbStore(path, nil, nil)
+	assert.NoError(t, err)
+	defer backup.Db.Close()
+	_, err = backup.GetTrekking("a")
+	assert.NoError(t, err)
+}
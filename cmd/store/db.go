@@ -6,44 +6,131 @@ import (
 	log "github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
 	"lootjestrekken/pkg/lootjestrekken"
+	"net/url"
 	"os"
+	"time"
 )
 
 const BucketName = "trekkingen"
+const TrashBucketName = "trash"
 
 type DbStore struct {
 	Db *bolt.DB
+	// keys encrypt the secrets of trekkingen, see Keys. Without keys trekkingen are stored as they
+	// are, and encrypted trekkingen can only be listed.
+	keys *Keys
+	watchers
 }
 
 func (i *DbStore) UpdateTrekking(trekking lootjestrekken.Trekking) error {
 	log.Debugf("updating trekking with name %s in store", trekking.Name)
 
-	jsont, err := json.Marshal(trekking)
-	if err != nil {
-		return err
-	}
-
-	err = i.Db.Update(func(tx *bolt.Tx) error {
+	return i.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
-		err := b.Put([]byte(trekking.Name), jsont)
-		return err
-	})
+		old, err := readTrekking(i.keys, b, trekking.Name)
+		if err != nil {
+			return err
+		}
+
+		if old.Version != trekking.Version {
+			return ErrConflict
+		}
 
-	return err
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		if err := updateTrekking(i.keys, b, old, trekking); err != nil {
+			return err
+		}
+		i.publishOnCommit(tx, changes(&old, &trekking))
+		return putIndex(tx, trekking)
+	})
 }
 
-func (i *DbStore) GetTrekking(name string) (lootjestrekken.Trekking, error) {
-	log.Debugf("getting trekking with name %s from store", name)
+func (i *DbStore) Modify(name string, change func(trekking *lootjestrekken.Trekking) error) error {
+	log.Debugf("modifying trekking with name %s in store", name)
 
-	var t lootjestrekken.Trekking
-	err := i.Db.View(func(tx *bolt.Tx) error {
+	return i.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
-		v := b.Get([]byte(name))
-		if err := json.Unmarshal(v, &t); err != nil {
+		old, err := readTrekking(i.keys, b, name)
+		if err != nil {
 			return err
 		}
 
-		return nil
+		t, err := copyTrekking(old)
+		if err != nil {
+			return err
+		}
+
+		if err := change(&t); err != nil {
+			return err
+		}
+
+		t.Name = name
+		t.Version = old.Version + 1
+		t.UpdatedAt = time.Now()
+		if err := updateTrekking(i.keys, b, old, t); err != nil {
+			return err
+		}
+		i.publishOnCommit(tx, changes(&old, &t))
+		return putIndex(tx, t)
+	})
+}
+
+// Append adds people to a trekking without reading or writing the people it already has, see
+// Appender.
+func (i *DbStore) Append(name string, change func(trekking *lootjestrekken.Trekking) error) error {
+	log.Debugf("appending to trekking with name %s in store", name)
+
+	return i.Db.Update(func(tx *bolt.Tx) error {
+		tb := tx.Bucket([]byte(BucketName)).Bucket([]byte(name))
+		if tb == nil {
+			return ErrNotFound
+		}
+
+		t, err := getMeta(i.keys, tb)
+		if err != nil {
+			return err
+		}
+
+		old := t
+		if err := change(&t); err != nil {
+			return err
+		}
+
+		t.Name = name
+		t.Version = old.Version + 1
+		t.UpdatedAt = time.Now()
+		if whole(tb) {
+			// the metadata of a trekking that is stored whole has all of it
+			if err := writeTrekking(i.keys, tx.Bucket([]byte(BucketName)), t); err != nil {
+				return err
+			}
+		} else {
+			if err := putMeta(i.keys, tb, t); err != nil {
+				return err
+			}
+			if err := putParticipants(i.keys, tb, name, t.People, t.Tokens); err != nil {
+				return err
+			}
+		}
+		i.publishOnCommit(tx, changes(&old, &t))
+		return putIndex(tx, t)
+	})
+}
+
+// publishOnCommit publishes events once tx is committed, and not if it is rolled back.
+func (i *DbStore) publishOnCommit(tx *bolt.Tx, events []Event) {
+	tx.OnCommit(func() {
+		i.publish(events...)
+	})
+}
+
+func (i *DbStore) get(bucket, name string) (lootjestrekken.Trekking, error) {
+	var t lootjestrekken.Trekking
+	err := i.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = readTrekking(i.keys, tx.Bucket([]byte(bucket)), name)
+		return err
 	})
 
 	if err != nil {
@@ -53,25 +140,21 @@ func (i *DbStore) GetTrekking(name string) (lootjestrekken.Trekking, error) {
 	return t, nil
 }
 
-func (i *DbStore) GetTrekkingNames() ([]string, error) {
-	log.Debug("getting all trekking names from store")
+func (i *DbStore) GetTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trekking with name %s from store", name)
 
+	return i.get(BucketName, name)
+}
+
+// names returns the keys of a bucket, which are sorted.
+func (i *DbStore) names(bucket string) ([]string, error) {
 	keys := make([]string, 0)
 
 	err := i.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var t lootjestrekken.Trekking
-			if err := json.Unmarshal(v, &t); err != nil {
-				return err
-			}
-
-			keys = append(keys, t.Name)
-		}
-
-		return nil
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
 	})
 
 	if err != nil {
@@ -81,25 +164,28 @@ func (i *DbStore) GetTrekkingNames() ([]string, error) {
 	return keys, nil
 }
 
+func (i *DbStore) GetTrekkingNames() ([]string, error) {
+	log.Debug("getting all trekking names from store")
+
+	return i.names(IndexBucketName)
+}
+
 func (i *DbStore) GetTrekkingInfos() ([]string, error) {
 	log.Debug("getting all trekking infos from store")
 
 	keys := make([]string, 0)
 
 	err := i.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var t lootjestrekken.Trekking
-			if err := json.Unmarshal(v, &t); err != nil {
+		return tx.Bucket([]byte(IndexBucketName)).ForEach(func(k, v []byte) error {
+			var entry indexEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
 				return err
 			}
 
+			t := lootjestrekken.Trekking{Name: string(k), Getrokken: entry.Getrokken}
 			keys = append(keys, t.GetInfo())
-		}
-
-		return nil
+			return nil
+		})
 	})
 
 	if err != nil {
@@ -113,23 +199,177 @@ func (i *DbStore) AddTrekking(name string, trekking lootjestrekken.Trekking) err
 	log.Debugf("Adding trekking with name %s to store", name)
 
 	trekking.Name = name
+	trekking.CreatedAt = time.Now()
+	trekking.UpdatedAt = trekking.CreatedAt
 
-	jsont, err := json.Marshal(trekking)
-	if err != nil {
-		return err
-	}
+	return i.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if b.Bucket([]byte(name)) != nil {
+			return ErrExists
+		}
+
+		if err := writeTrekking(i.keys, b, trekking); err != nil {
+			return err
+		}
+		i.publishOnCommit(tx, changes(nil, &trekking))
+		return putIndex(tx, trekking)
+	})
+}
 
-	err = i.Db.Update(func(tx *bolt.Tx) error {
+func (i *DbStore) DeleteTrekking(name string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Deleting trekking with name %s from store", name)
+
+	return i.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
-		if b.Get([]byte(name)) != nil {
+		t, err := readTrekking(i.keys, b, name)
+		if err != nil {
+			return err
+		}
+
+		if err := checked(check, t); err != nil {
+			return err
+		}
+
+		trash := tx.Bucket([]byte(TrashBucketName))
+		if trash.Bucket([]byte(name)) != nil {
 			return ErrExists
 		}
 
-		err := b.Put([]byte(name), jsont)
-		return err
+		t.Trash(time.Now())
+		if err := writeTrekking(i.keys, trash, t); err != nil {
+			return err
+		}
+
+		if err := b.DeleteBucket([]byte(name)); err != nil {
+			return err
+		}
+		i.publishOnCommit(tx, changes(&t, nil))
+		return deleteIndex(tx, name)
+	})
+}
+
+// move stores the trekking under name in bucket from as newname in bucket to, changed by change, in
+// a single transaction, after check accepts it. The original is kept if keep is set.
+func (i *DbStore) move(from, to, name, newname string, check func(trekking lootjestrekken.Trekking) error, change func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking, keep bool) error {
+	return i.Db.Update(func(tx *bolt.Tx) error {
+		fb := tx.Bucket([]byte(from))
+		tb := tx.Bucket([]byte(to))
+		t, err := readTrekking(i.keys, fb, name)
+		if err != nil {
+			return err
+		}
+
+		if err := checked(check, t); err != nil {
+			return err
+		}
+
+		if tb.Bucket([]byte(newname)) != nil {
+			return ErrExists
+		}
+
+		old := t
+		t = change(t)
+		t.Name = newname
+
+		// the new name is part of what is encrypted, so everything is written again
+		if err := writeTrekking(i.keys, tb, t); err != nil {
+			return err
+		}
+		if err := putIndex(tx, t); err != nil {
+			return err
+		}
+
+		if keep {
+			i.publishOnCommit(tx, changes(nil, &t))
+			return nil
+		}
+		if err := fb.DeleteBucket([]byte(name)); err != nil {
+			return err
+		}
+		if from == TrashBucketName {
+			i.publishOnCommit(tx, changes(nil, &t))
+			return nil
+		}
+		i.publishOnCommit(tx, append(changes(&old, nil), changes(nil, &t)...))
+		return deleteIndex(tx, name)
 	})
+}
+
+func (i *DbStore) RenameTrekking(name, newname string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Renaming trekking with name %s to %s in store", name, newname)
+
+	return i.move(BucketName, BucketName, name, newname, check, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *DbStore) CloneTrekking(name, newname string) error {
+	log.Debugf("Cloning trekking with name %s to %s in store", name, newname)
+
+	return i.move(BucketName, BucketName, name, newname, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		clone := trekking.Clone()
+		clone.CreatedAt = time.Now()
+		clone.UpdatedAt = clone.CreatedAt
+		return clone
+	}, true)
+}
+
+func (i *DbStore) GetTrashNames() ([]string, error) {
+	log.Debug("getting all trashed trekking names from store")
+
+	return i.names(TrashBucketName)
+}
+
+func (i *DbStore) GetTrashedTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trashed trekking with name %s from store", name)
+
+	return i.get(TrashBucketName, name)
+}
+
+func (i *DbStore) RestoreTrekking(name string) error {
+	log.Debugf("Restoring trekking with name %s in store", name)
+
+	return i.move(TrashBucketName, BucketName, name, name, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Restore()
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *DbStore) PurgeTrash(before time.Time) error {
+	log.Debugf("Purging trekkingen trashed before %s from store", before)
+
+	return i.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(TrashBucketName))
+
+		// bolt doesn't allow deleting while iterating with ForEach
+		var purge [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			// the time it was trashed isn't encrypted, so this works without keys
+			t, err := decodePublic(b.Bucket(k).Get(metaKey))
+			if err != nil {
+				return err
+			}
+
+			if t.TrashedBefore(before) {
+				purge = append(purge, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 
-	return err
+		for _, k := range purge {
+			if err := b.DeleteBucket(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func exists(filename string) bool {
@@ -141,27 +381,123 @@ func exists(filename string) bool {
 }
 
 func NewDbStore(location string) (*DbStore, error) {
-	dbloc := location + "/lootjestrekken.db"
 	if !exists(location) {
 		return nil, fmt.Errorf("directory %s does not exist", location)
 	}
 
-	db, err := bolt.Open(dbloc, 0666, nil)
+	return OpenDbStore(location+"/lootjestrekken.db", nil, nil)
+}
+
+// reencrypt stores every trekking that isn't encrypted with the current key again, so that a new key
+// takes over from the old ones and trekkingen from before encryption get encrypted.
+func (i *DbStore) reencrypt(tx *bolt.Tx) error {
+	current := i.keys.current()
+	for _, bucket := range []string{BucketName, TrashBucketName} {
+		b := tx.Bucket([]byte(bucket))
+
+		// bolt doesn't allow changing a bucket while iterating with ForEach, and all parts of a
+		// trekking are written with the same key, so its metadata tells whether it is up to date
+		var changed []lootjestrekken.Trekking
+		err := b.ForEach(func(k, v []byte) error {
+			sealed, err := sealedWith(b.Bucket(k).Get(metaKey))
+			if err != nil || (sealed != nil && sealed.Key == current) {
+				return err
+			}
+
+			t, err := readTrekking(i.keys, b, string(k))
+			if err != nil {
+				return err
+			}
+			changed = append(changed, t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, t := range changed {
+			log.Infof("Encrypted trekking %s with key %s", t.Name, current)
+			if err := writeTrekking(i.keys, b, t); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// OpenDbStore uses the bolt database in the given file, creating it if needed. An older database is
+// migrated to SchemaVersion, a newer one is refused with ErrNewerSchema. With keys, every trekking
+// is encrypted with the first key. Without keys, encrypted trekkingen can still be listed.
+func OpenDbStore(dbloc string, options *bolt.Options, keys *Keys) (*DbStore, error) {
+	db, err := bolt.Open(dbloc, 0666, options)
 	if err != nil {
 		return nil, err
 	}
 
+	s := &DbStore{
+		Db:   db,
+		keys: keys,
+	}
+
 	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucket([]byte(BucketName))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
+		if err := createBuckets(tx); err != nil {
+			return err
 		}
-		return nil
+		if err := migrate(tx, keys, logMigration); err != nil {
+			return err
+		}
+		if keys == nil {
+			return nil
+		}
+		return s.reencrypt(tx)
 	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// boltURL returns the path, options and keys of a bolt:// url. The timeout is how long to wait for
+// another process that has the database open, the keyfile is read with ReadKeyFile.
+func boltURL(u *url.URL) (string, *bolt.Options, *Keys, error) {
+	path, err := filePath(u)
+	if err != nil {
+		return "", nil, nil, err
+	}
 
-	return &DbStore {
-		Db: db,
-	}, nil
+	query, err := options(u, "timeout", "keyfile")
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var keys *Keys
+	if keyfile := query.Get("keyfile"); keyfile != "" {
+		if keys, err = ReadKeyFile(keyfile); err != nil {
+			return "", nil, nil, fmt.Errorf("invalid keyfile: %w", err)
+		}
+	}
+
+	opts := &bolt.Options{Timeout: time.Second}
+	if timeout := query.Get("timeout"); timeout != "" {
+		if opts.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return "", nil, nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	return path, opts, keys, nil
 }
 
+func init() {
+	// bolt:///data/lootjes.db?timeout=1s&keyfile=/run/secrets/lootjes.key
+	Register("bolt", func(u *url.URL) (Store, error) {
+		path, opts, keys, err := boltURL(u)
+		if err != nil {
+			return nil, err
+		}
 
+		return OpenDbStore(path, opts, keys)
+	})
+}
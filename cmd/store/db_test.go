@@ -0,0 +1,39 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"testing"
+)
+
+func TestDbStoreMigratesPeople(t *testing.T) {
+	dir := t.TempDir()
+	db, err := bolt.Open(dir+"/lootjestrekken.db", 0666, nil)
+	assert.NoError(t, err)
+
+	legacy := `{"Name": "old", "People": ["a", "b"], "PeopleMapping": ["b", "a"], "Getrokken": true}`
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("old"), []byte(legacy))
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	s, err := NewDbStore(dir)
+	assert.NoError(t, err)
+	defer s.Db.Close()
+
+	people := rawParticipants(t, s, "old")
+	if assert.Len(t, people, 2) {
+		assert.JSONEq(t, `{"ID": "a", "Name": "a"}`, people[0])
+	}
+
+	trekking, err := s.GetTrekking("old")
+	assert.NoError(t, err)
+	res, err := trekking.GetrokkenPerson("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", res.ID)
+}
@@ -0,0 +1,640 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidFile = errors.New("invalid trekking file")
+
+// Checker is a store that can check the data it keeps, like files that were edited by hand.
+type Checker interface {
+	// Check returns a problem for every trekking that can't be read.
+	Check() []error
+}
+
+const (
+	// lockName is the file DirStore locks, so that several processes can use the same directory.
+	lockName = ".lock"
+	// trashDir is the directory in a DirStore with the trekkingen in the trash.
+	trashDir = "trash"
+)
+
+// DirStore keeps every trekking in a file of its own in a directory, as indented json or yaml, so the
+// directory can be kept in version control. The file of a trekking is its name, escaped like a url
+// path and with its upper-case letters escaped as well, with the extension of the format. Trekkingen
+// in the trash are in the trash directory. Other files are left alone, and the .lock file is best
+// kept out of version control.
+//
+// Every read reads the files again, so changes made by hand are seen right away. A file that can't be
+// read, or that doesn't make sense, gives an ErrInvalidFile that tells what is wrong with it.
+type DirStore struct {
+	Dir string
+	// Format is "json" or "yaml", the format the files are read and written in.
+	Format string
+	mu     sync.RWMutex
+	watchers
+}
+
+// fileName returns the name of the file of a trekking without extension. Escaping keeps names like
+// a/b and .. inside the directory, and escaping upper-case letters keeps b and B apart on file systems
+// that ignore case.
+func fileName(name string) string {
+	escaped := url.PathEscape(name)
+	if strings.HasPrefix(escaped, ".") {
+		escaped = "%2E" + escaped[1:]
+	}
+
+	// the hex digits after a % are upper-case too, and are kept
+	var b strings.Builder
+	for k := 0; k < len(escaped); k++ {
+		switch c := escaped[k]; {
+		case c == '%':
+			b.WriteString(escaped[k : k+3])
+			k += 2
+		case c >= 'A' && c <= 'Z':
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (i *DirStore) path(trashed bool, name string) string {
+	if trashed {
+		return filepath.Join(i.Dir, trashDir, fileName(name)+"."+i.Format)
+	}
+	return filepath.Join(i.Dir, fileName(name)+"."+i.Format)
+}
+
+// locked runs fn while holding the lock of the directory, exclusively when it changes trekkingen.
+func (i *DirStore) locked(exclusive bool, fn func() error) error {
+	if exclusive {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+	} else {
+		i.mu.RLock()
+		defer i.mu.RUnlock()
+	}
+
+	f, err := os.OpenFile(filepath.Join(i.Dir, lockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(f, exclusive); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", f.Name(), err)
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
+
+// change is locked for a change that publishes the events fn returns once it is done.
+func (i *DirStore) change(fn func() ([]Event, error)) error {
+	var events []Event
+	err := i.locked(true, func() error {
+		var err error
+		events, err = fn()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	i.publish(events...)
+	return nil
+}
+
+func (i *DirStore) encode(trekking lootjestrekken.Trekking) ([]byte, error) {
+	v, err := json.MarshalIndent(trekking, "", "  ")
+	if err != nil || i.Format == "json" {
+		return append(v, '\n'), err
+	}
+
+	// going through json keeps the field names and order of json, and yaml writes json in flow style
+	// unless that is undone
+	var node yaml.Node
+	if err := yaml.Unmarshal(v, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	return buf.Bytes(), err
+}
+
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, i := range node.Content {
+		blockStyle(i)
+	}
+}
+
+func (i *DirStore) decode(v []byte) (lootjestrekken.Trekking, error) {
+	var t lootjestrekken.Trekking
+	if i.Format == "json" {
+		if err := json.Unmarshal(v, &t); err != nil {
+			return t, jsonError(v, err)
+		}
+		return t, nil
+	}
+
+	// Trekking decodes itself from json, so yaml is decoded through json
+	var doc interface{}
+	if err := yaml.Unmarshal(v, &doc); err != nil {
+		return t, err
+	}
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(j, &t); err != nil {
+		return t, jsonError(nil, err)
+	}
+	return t, nil
+}
+
+// jsonError adds the line of a json syntax error in v to it, and makes type errors say which field
+// has the wrong type.
+func jsonError(v []byte, err error) error {
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) && v != nil {
+		return fmt.Errorf("line %d: %v", bytes.Count(v[:syntax.Offset], []byte("\n"))+1, err)
+	}
+
+	var typ *json.UnmarshalTypeError
+	if errors.As(err, &typ) {
+		return fmt.Errorf("%s should be %s, not %s", typ.Field, typ.Type, typ.Value)
+	}
+	return err
+}
+
+// validate checks what could go wrong when a trekking is edited by hand.
+func validate(name string, trekking lootjestrekken.Trekking) error {
+	if trekking.Name != "" && trekking.Name != name {
+		return fmt.Errorf("it has name %q, the name of the file is %q", trekking.Name, name)
+	}
+
+	ids := map[string]bool{}
+	for index, i := range trekking.People {
+		if i.ID == "" {
+			return fmt.Errorf("person %d (%s) has no ID", index+1, i.Name)
+		}
+		if ids[i.ID] {
+			return fmt.Errorf("person %d (%s) has ID %s, which is already used by someone else", index+1, i.Name, i.ID)
+		}
+		ids[i.ID] = true
+	}
+
+	if !trekking.Getrokken {
+		return nil
+	}
+	if len(trekking.PeopleMapping) != len(trekking.People) {
+		return fmt.Errorf("it is getrokken, but its PeopleMapping has %d people instead of %d", len(trekking.PeopleMapping), len(trekking.People))
+	}
+	for index, i := range trekking.PeopleMapping {
+		if !ids[i] {
+			return fmt.Errorf("PeopleMapping %d is %s, which is not the ID of a person, or is in it twice", index+1, i)
+		}
+		delete(ids, i)
+	}
+	return nil
+}
+
+// read reads the trekking with the given name, from the trash if trashed is set.
+func (i *DirStore) read(trashed bool, name string) (lootjestrekken.Trekking, error) {
+	path := i.path(trashed, name)
+	v, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lootjestrekken.Trekking{}, ErrNotFound
+	}
+	if err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+
+	t, err := i.decode(v)
+	if err == nil {
+		err = validate(name, t)
+	}
+	if err != nil {
+		return lootjestrekken.Trekking{}, fmt.Errorf("%w %s: %v", ErrInvalidFile, path, err)
+	}
+
+	t.Name = name
+	return t, nil
+}
+
+func (i *DirStore) write(trashed bool, trekking lootjestrekken.Trekking) error {
+	v, err := i.encode(trekking)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(i.path(trashed, trekking.Name), v)
+}
+
+func (i *DirStore) remove(trashed bool, name string) error {
+	return os.Remove(i.path(trashed, name))
+}
+
+func (i *DirStore) exists(trashed bool, name string) bool {
+	return exists(i.path(trashed, name))
+}
+
+// names returns the names of the trekkingen in the directory, or in the trash, sorted. Files with the
+// extension of the format that aren't the file of a trekking are logged and left out, see files.
+func (i *DirStore) names(trashed bool) ([]string, error) {
+	names, problems, err := i.files(trashed)
+	for _, k := range problems {
+		log.Warnf("Ignoring %v", k)
+	}
+	return names, err
+}
+
+// files returns the names of the trekkingen in the directory, or in the trash, sorted, and an
+// ErrInvalidFile for every file with the extension of the format that isn't the file of the name it
+// unescapes to, like a file named by hand with a space or an upper-case letter.
+func (i *DirStore) files(trashed bool) ([]string, []error, error) {
+	dir := i.Dir
+	if trashed {
+		dir = filepath.Join(i.Dir, trashDir)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	var problems []error
+	for _, f := range files {
+		base := strings.TrimSuffix(f.Name(), "."+i.Format)
+		if f.IsDir() || base == f.Name() || strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name())
+		name, err := url.PathUnescape(base)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%w %s: it isn't the name of a trekking: %v", ErrInvalidFile, path, err))
+			continue
+		}
+		if fileName(name) != base {
+			problems = append(problems, fmt.Errorf("%w %s: the file of trekking %q should be named %s", ErrInvalidFile, path, name, fileName(name)+"."+i.Format))
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, problems, nil
+}
+
+func (i *DirStore) AddTrekking(name string, trekking lootjestrekken.Trekking) error {
+	log.Debugf("Adding trekking with name %s to store", name)
+
+	trekking.Name = name
+	trekking.CreatedAt = time.Now()
+	trekking.UpdatedAt = trekking.CreatedAt
+
+	return i.change(func() ([]Event, error) {
+		if i.exists(false, name) {
+			return nil, ErrExists
+		}
+
+		return changes(nil, &trekking), i.write(false, trekking)
+	})
+}
+
+func (i *DirStore) GetTrekkingNames() ([]string, error) {
+	log.Debug("getting all trekking names from store")
+
+	var names []string
+	err := i.locked(false, func() error {
+		var err error
+		names, err = i.names(false)
+		return err
+	})
+	return names, err
+}
+
+func (i *DirStore) GetTrekkingInfos() ([]string, error) {
+	log.Debug("getting all trekking infos from store")
+
+	var infos []string
+	err := i.locked(false, func() error {
+		names, err := i.names(false)
+		if err != nil {
+			return err
+		}
+
+		infos = make([]string, 0, len(names))
+		for _, k := range names {
+			t, err := i.read(false, k)
+			if errors.Is(err, ErrInvalidFile) {
+				// one broken file doesn't hide the others
+				log.Warn(err)
+				t = lootjestrekken.Trekking{Name: k}
+			} else if err != nil {
+				return err
+			}
+			infos = append(infos, t.GetInfo())
+		}
+		return nil
+	})
+	return infos, err
+}
+
+func (i *DirStore) GetTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trekking with name %s from store", name)
+
+	var t lootjestrekken.Trekking
+	err := i.locked(false, func() error {
+		var err error
+		t, err = i.read(false, name)
+		return err
+	})
+	return t, err
+}
+
+func (i *DirStore) UpdateTrekking(trekking lootjestrekken.Trekking) error {
+	log.Debugf("updating trekking with name %s in store", trekking.Name)
+
+	return i.change(func() ([]Event, error) {
+		old, err := i.read(false, trekking.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if old.Version != trekking.Version {
+			return nil, ErrConflict
+		}
+
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return changes(&old, &trekking), i.write(false, trekking)
+	})
+}
+
+func (i *DirStore) Modify(name string, change func(trekking *lootjestrekken.Trekking) error) error {
+	log.Debugf("modifying trekking with name %s in store", name)
+
+	return i.change(func() ([]Event, error) {
+		old, err := i.read(false, name)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := copyTrekking(old)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := change(&t); err != nil {
+			return nil, err
+		}
+
+		t.Name = name
+		t.Version = old.Version + 1
+		t.UpdatedAt = time.Now()
+		return changes(&old, &t), i.write(false, t)
+	})
+}
+
+func (i *DirStore) DeleteTrekking(name string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Deleting trekking with name %s from store", name)
+
+	return i.change(func() ([]Event, error) {
+		t, err := i.read(false, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checked(check, t); err != nil {
+			return nil, err
+		}
+
+		if i.exists(true, name) {
+			return nil, ErrExists
+		}
+
+		t.Trash(time.Now())
+		if err := i.write(true, t); err != nil {
+			return nil, err
+		}
+		return changes(&t, nil), i.remove(false, name)
+	})
+}
+
+// move stores the trekking under name, from the trash if trashed is set, as newname, changed by
+// change, after check accepts it. The original is kept if keep is set.
+func (i *DirStore) move(name string, trashed bool, newname string, check func(trekking lootjestrekken.Trekking) error, change func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking, keep bool) error {
+	return i.change(func() ([]Event, error) {
+		old, err := i.read(trashed, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checked(check, old); err != nil {
+			return nil, err
+		}
+
+		if i.exists(false, newname) {
+			return nil, ErrExists
+		}
+
+		t := change(old)
+		t.Name = newname
+		if err := i.write(false, t); err != nil {
+			return nil, err
+		}
+
+		events := changes(nil, &t)
+		if keep {
+			return events, nil
+		}
+		if !trashed {
+			events = append(changes(&old, nil), events...)
+		}
+		return events, i.remove(trashed, name)
+	})
+}
+
+func (i *DirStore) RenameTrekking(name, newname string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Renaming trekking with name %s to %s in store", name, newname)
+
+	return i.move(name, false, newname, check, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *DirStore) CloneTrekking(name, newname string) error {
+	log.Debugf("Cloning trekking with name %s to %s in store", name, newname)
+
+	return i.move(name, false, newname, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		clone := trekking.Clone()
+		clone.CreatedAt = time.Now()
+		clone.UpdatedAt = clone.CreatedAt
+		return clone
+	}, true)
+}
+
+func (i *DirStore) GetTrashNames() ([]string, error) {
+	log.Debug("getting all trashed trekking names from store")
+
+	var names []string
+	err := i.locked(false, func() error {
+		var err error
+		names, err = i.names(true)
+		return err
+	})
+	return names, err
+}
+
+func (i *DirStore) GetTrashedTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trashed trekking with name %s from store", name)
+
+	var t lootjestrekken.Trekking
+	err := i.locked(false, func() error {
+		var err error
+		t, err = i.read(true, name)
+		return err
+	})
+	return t, err
+}
+
+func (i *DirStore) RestoreTrekking(name string) error {
+	log.Debugf("Restoring trekking with name %s in store", name)
+
+	return i.move(name, true, name, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Restore()
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *DirStore) PurgeTrash(before time.Time) error {
+	log.Debugf("Purging trekkingen trashed before %s from store", before)
+
+	return i.change(func() ([]Event, error) {
+		names, err := i.names(true)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range names {
+			t, err := i.read(true, k)
+			if errors.Is(err, ErrInvalidFile) {
+				log.Warnf("Not purging a file that can't be read: %v", err)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if t.TrashedBefore(before) {
+				if err := i.remove(true, k); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	})
+}
+
+// Check reads all trekkingen, also those in the trash, and returns what is wrong with the files that
+// can't be read, and with the files that aren't named like the trekking they would be.
+func (i *DirStore) Check() []error {
+	var problems []error
+	err := i.locked(false, func() error {
+		for _, trashed := range []bool{false, true} {
+			names, invalid, err := i.files(trashed)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, invalid...)
+
+			for _, k := range names {
+				if _, err := i.read(trashed, k); err != nil {
+					problems = append(problems, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, err)
+	}
+	return problems
+}
+
+// NewDirStore uses the trekkingen in dir, in format "json" or "yaml". It logs the problems of the
+// files that can't be read, see Check.
+func NewDirStore(dir, format string) (*DirStore, error) {
+	if format != "json" && format != "yaml" {
+		return nil, fmt.Errorf("unknown format %s, use json or yaml", format)
+	}
+
+	if !exists(dir) {
+		return nil, fmt.Errorf("directory %s does not exist", dir)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, trashDir), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &DirStore{
+		Dir:    dir,
+		Format: format,
+	}
+	for _, i := range s.Check() {
+		log.Warn(i)
+	}
+	return s, nil
+}
+
+func init() {
+	// dir:///data/trekkingen?format=yaml, the format is json by default
+	Register("dir", func(u *url.URL) (Store, error) {
+		path, err := filePath(u)
+		if err != nil {
+			return nil, err
+		}
+
+		query, err := options(u, "format")
+		if err != nil {
+			return nil, err
+		}
+
+		format := query.Get("format")
+		if format == "" {
+			format = "json"
+		}
+
+		return NewDirStore(path, format)
+	})
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lootjestrekken/pkg/lootjestrekken"
+	"path/filepath"
+	"testing"
+)
+
+func newDirStore(t *testing.T, format string) *DirStore {
+	s, err := NewDirStore(t.TempDir(), format)
+	require.NoError(t, err)
+	return s
+}
+
+func TestDirFiles(t *testing.T) {
+	s := newDirStore(t, "yaml")
+	for _, name := range []string{"kerst", "a/b", "..", ".lock", "50%", "B", "b"} {
+		require.NoError(t, s.AddTrekking(name, lootjestrekken.Trekking{}), name)
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.yaml"))
+	require.NoError(t, err)
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	assert.ElementsMatch(t, []string{"kerst.yaml", "a%2Fb.yaml", "%2E..yaml", "%2Elock.yaml", "50%25.yaml", "%42.yaml", "b.yaml"}, files)
+
+	names, err := s.GetTrekkingNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"..", ".lock", "50%", "B", "a/b", "b", "kerst"}, names)
+
+	require.NoError(t, s.DeleteTrekking("a/b", nil))
+	assert.FileExists(t, filepath.Join(s.Dir, "trash", "a%2Fb.yaml"))
+}
+
+func TestDirHandNamed(t *testing.T) {
+	s := newDirStore(t, "json")
+	require.NoError(t, s.AddTrekking("kerst 2024", lootjestrekken.Trekking{}))
+	assert.FileExists(t, filepath.Join(s.Dir, "kerst%202024.json"))
+
+	// files named by hand that wouldn't be found under the name they unescape to aren't listed
+	for _, name := range []string{"oud en nieuw.json", "Pasen.json", "50%.json"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(s.Dir, name), []byte("{}"), 0600))
+	}
+
+	names, err := s.GetTrekkingNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kerst 2024"}, names)
+
+	_, err = s.GetTrekking("oud en nieuw")
+	assert.Equal(t, ErrNotFound, err)
+
+	problems := s.Check()
+	if assert.Len(t, problems, 3) {
+		for _, i := range problems {
+			assert.True(t, errors.Is(i, ErrInvalidFile))
+		}
+		assert.Contains(t, problems[0].Error(), "it isn't the name of a trekking")
+		assert.Contains(t, problems[1].Error(), `the file of trekking "Pasen" should be named %50asen.json`)
+		assert.Contains(t, problems[2].Error(), `the file of trekking "oud en nieuw" should be named oud%20en%20nieuw.json`)
+	}
+}
+
+func TestDirHandEdited(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			s := newDirStore(t, format)
+			require.NoError(t, s.AddTrekking("kerst", lootjestrekken.Trekking{People: []lootjestrekken.Participant{{ID: "1", Name: "jan"}}}))
+
+			path := filepath.Join(s.Dir, "kerst."+format)
+			v, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			assert.Contains(t, string(v), "jan")
+
+			// a file that is added by hand only needs the people
+			added := map[string]string{
+				"json": `{"People": [{"ID": "1", "Name": "klaas"}, {"ID": "2", "Name": "true"}]}`,
+				"yaml": "People:\n  - ID: 1\n    Name: klaas\n  - ID: \"2\"\n    Name: \"true\"\n",
+			}
+			require.NoError(t, ioutil.WriteFile(filepath.Join(s.Dir, "oud."+format), []byte(added[format]), 0600))
+
+			names, err := s.GetTrekkingNames()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"kerst", "oud"}, names)
+
+			if format == "json" {
+				oud, err := s.GetTrekking("oud")
+				require.NoError(t, err)
+				assert.Equal(t, "oud", oud.Name)
+				assert.Equal(t, []lootjestrekken.Participant{{ID: "1", Name: "klaas"}, {ID: "2", Name: "true"}}, oud.People)
+			} else {
+				// yaml reads an unquoted 1 as a number, which is reported instead of guessed
+				_, err := s.GetTrekking("oud")
+				assert.True(t, errors.Is(err, ErrInvalidFile))
+				assert.Contains(t, err.Error(), "oud.yaml")
+				assert.Contains(t, err.Error(), "ID should be string, not number")
+			}
+			assert.NoError(t, s.Modify("kerst", func(trekking *lootjestrekken.Trekking) error {
+				trekking.People[0].Name = "piet"
+				return nil
+			}))
+
+			kerst, err := s.GetTrekking("kerst")
+			require.NoError(t, err)
+			assert.Equal(t, "piet", kerst.People[0].Name)
+			assert.Equal(t, uint64(1), kerst.Version)
+		})
+	}
+}
+
+func TestDirInvalidFiles(t *testing.T) {
+	s := newDirStore(t, "json")
+	require.NoError(t, s.AddTrekking("kerst", lootjestrekken.Trekking{}))
+
+	for name, tc := range map[string]struct {
+		contents string
+		problem  string
+	}{
+		"syntax":    {"{\n  \"People\": [\n    {\"ID\": \"1\",}\n  ]\n}\n", "line 3: invalid character '}'"},
+		"name":      {`{"Name": "sinterklaas"}`, `it has name "sinterklaas", the name of the file is "name"`},
+		"noid":      {`{"People": [{"Name": "jan"}]}`, "person 1 (jan) has no ID"},
+		"twice":     {`{"People": [{"ID": "1", "Name": "jan"}, {"ID": "1", "Name": "piet"}]}`, "person 2 (piet) has ID 1, which is already used by someone else"},
+		"mapping":   {`{"Getrokken": true, "People": [{"ID": "1"}, {"ID": "2"}], "PeopleMapping": ["2"]}`, "PeopleMapping has 1 people instead of 2"},
+		"unknownid": {`{"Getrokken": true, "People": [{"ID": "1"}, {"ID": "2"}], "PeopleMapping": ["2", "2"]}`, "PeopleMapping 2 is 2"},
+	} {
+		path := filepath.Join(s.Dir, name+".json")
+		require.NoError(t, ioutil.WriteFile(path, []byte(tc.contents), 0600))
+
+		_, err := s.GetTrekking(name)
+		if assert.True(t, errors.Is(err, ErrInvalidFile), name) {
+			assert.Contains(t, err.Error(), path, name)
+			assert.Contains(t, err.Error(), tc.problem, name)
+		}
+	}
+
+	// the other trekkingen can still be used, and the broken ones are listed
+	infos, err := s.GetTrekkingInfos()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 7)
+	assert.NoError(t, s.DeleteTrekking("kerst", nil))
+	assert.Len(t, s.Check(), 6)
+
+	err = s.DeleteTrekking("noid", nil)
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+}
+
+func TestDirYAML(t *testing.T) {
+	s := newDirStore(t, "yaml")
+	trekking := lootjestrekken.Trekking{
+		People: []lootjestrekken.Participant{
+			{ID: "1", Name: "true", Attributes: map[string]string{"allergie": "noten"}},
+			{ID: "2", Name: "123", Email: "piet@example.com"},
+		},
+		Getrokken:     true,
+		PeopleMapping: []string{"2", "1"},
+	}
+	require.NoError(t, s.AddTrekking("kerst", trekking))
+
+	v, err := ioutil.ReadFile(filepath.Join(s.Dir, "kerst.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(v), "People:\n  - ID: \"1\"\n    Name: \"true\"\n")
+	assert.Contains(t, string(v), "PeopleMapping:\n  - \"2\"\n  - \"1\"\n")
+
+	got, err := s.GetTrekking("kerst")
+	require.NoError(t, err)
+	assert.Equal(t, trekking.People, got.People)
+	assert.Equal(t, trekking.PeopleMapping, got.PeopleMapping)
+	assert.True(t, got.Getrokken)
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lootjestrekken/pkg/lootjestrekken"
+	"os"
+	"strings"
+)
+
+// KeySize is the size of an encryption key, for AES-256.
+const KeySize = 32
+
+var ErrEncrypted = errors.New("trekking is encrypted with a key the store doesn't have")
+
+// Keys encrypt the draw and the contact data of the people of trekkingen. The first key encrypts,
+// all of them decrypt, so that records can be moved to a new key while the old one is still known.
+type Keys struct {
+	keys []key
+}
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewKeys makes Keys of secrets of KeySize bytes, the current key first.
+func NewKeys(secrets ...[]byte) (*Keys, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("no keys")
+	}
+
+	keys := &Keys{}
+	for _, i := range secrets {
+		if len(i) != KeySize {
+			return nil, fmt.Errorf("a key has %d bytes, it needs %d", len(i), KeySize)
+		}
+
+		block, err := aes.NewCipher(i)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		// the id tells which key a record was encrypted with, without giving the key away
+		sum := sha256.Sum256(i)
+		keys.keys = append(keys.keys, key{id: hex.EncodeToString(sum[:4]), aead: aead})
+	}
+	return keys, nil
+}
+
+// ReadKeyFile reads keys from a file with a base64 key on every line, the current key first.
+func ReadKeyFile(path string) (*Keys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var secrets [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", len(secrets)+1, err)
+		}
+		secrets = append(secrets, secret)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewKeys(secrets...)
+}
+
+// current returns the id of the key that encrypts.
+func (k *Keys) current() string {
+	return k.keys[0].id
+}
+
+func (k *Keys) find(id string) (key, bool) {
+	for _, i := range k.keys {
+		if i.id == id {
+			return i, true
+		}
+	}
+	return key{}, false
+}
+
+// record is how a trekking is stored. When it is encrypted, the secrets are left out of the trekking
+// and kept in Sealed. Trekking decodes itself, so a record is decoded with decodePublic and
+// sealedWith instead.
+type record struct {
+	lootjestrekken.Trekking
+	Sealed *sealed `json:",omitempty"`
+}
+
+type sealed struct {
+	Key  string
+	Data []byte
+}
+
+// secrets are the parts of a trekking that are encrypted: everything that tells who drew whom, and
+// the contact data of the people.
+type secrets struct {
+	PeopleMapping []string
+	// Seed gives the draw away for anyone who knows how it was made.
+	Seed    []byte
+	History []lootjestrekken.PastDraw
+	// Inputs hold the earlier draws too.
+	Inputs *lootjestrekken.AuditInputs `json:",omitempty"`
+	// Contacts holds the contact data of every person in People, in the same order.
+	Contacts []contact
+}
+
+type contact struct {
+	Email      string            `json:",omitempty"`
+	Attributes map[string]string `json:",omitempty"`
+}
+
+// seal encrypts the json of v with the current key, authenticating it for aad, the place it is
+// stored at. Without keys there is nothing to seal and it returns nil.
+func (k *Keys) seal(v interface{}, aad string) (*sealed, error) {
+	if k == nil {
+		return nil, nil
+	}
+
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	current := k.keys[0]
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &sealed{Key: current.id, Data: current.aead.Seal(nonce, nonce, plain, []byte(aad))}, nil
+}
+
+// open decrypts what seal sealed for aad into v. It returns ErrEncrypted when its key is not one of
+// the keys.
+func (k *Keys) open(s *sealed, aad string, v interface{}) error {
+	var found key
+	ok := false
+	if k != nil {
+		found, ok = k.find(s.Key)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s is encrypted with key %s", ErrEncrypted, aad, s.Key)
+	}
+
+	size := found.aead.NonceSize()
+	if len(s.Data) < size {
+		return fmt.Errorf("encrypted data of %s is too short", aad)
+	}
+	plain, err := found.aead.Open(nil, s.Data[:size], s.Data[size:], []byte(aad))
+	if err != nil {
+		return fmt.Errorf("couldn't decrypt %s: %w", aad, err)
+	}
+
+	return json.Unmarshal(plain, v)
+}
+
+// encode returns a trekking as it is stored. Without keys it is stored as it is.
+func (k *Keys) encode(trekking lootjestrekken.Trekking) ([]byte, error) {
+	if k == nil {
+		return json.Marshal(trekking)
+	}
+
+	s := secrets{PeopleMapping: trekking.PeopleMapping, Seed: trekking.Seed, History: trekking.History, Inputs: trekking.Inputs, Contacts: make([]contact, 0, len(trekking.People))}
+	people := make([]lootjestrekken.Participant, 0, len(trekking.People))
+	for _, i := range trekking.People {
+		s.Contacts = append(s.Contacts, contact{Email: i.Email, Attributes: i.Attributes})
+		people = append(people, lootjestrekken.Participant{ID: i.ID, Name: i.Name})
+	}
+
+	// the name is authenticated too, so that the draw of one trekking can't be passed off as that of another
+	sealed, err := k.seal(s, trekking.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	trekking.People = people
+	trekking.PeopleMapping = nil
+	trekking.Seed = nil
+	trekking.History = nil
+	trekking.Inputs = nil
+	return json.Marshal(record{Trekking: trekking, Sealed: sealed})
+}
+
+// decode returns a stored trekking. It returns ErrEncrypted for an encrypted trekking when its key is
+// not one of the keys.
+func (k *Keys) decode(v []byte) (lootjestrekken.Trekking, error) {
+	t, err := decodePublic(v)
+	if err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+
+	sealed, err := sealedWith(v)
+	if err != nil || sealed == nil {
+		return t, err
+	}
+
+	var s secrets
+	if err := k.open(sealed, t.Name, &s); err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+	if len(s.Contacts) != len(t.People) {
+		return lootjestrekken.Trekking{}, fmt.Errorf("encrypted data of %s doesn't match its people", t.Name)
+	}
+
+	t.PeopleMapping = s.PeopleMapping
+	t.Seed = s.Seed
+	t.History = s.History
+	t.Inputs = s.Inputs
+	for index, i := range s.Contacts {
+		t.People[index].Email = i.Email
+		t.People[index].Attributes = i.Attributes
+	}
+	return t, nil
+}
+
+// decodePublic returns a stored trekking without its encrypted data, which is enough to list it or
+// to purge it from the trash.
+func decodePublic(v []byte) (lootjestrekken.Trekking, error) {
+	var t lootjestrekken.Trekking
+	err := json.Unmarshal(v, &t)
+	return t, err
+}
+
+// sealedWith returns the encrypted secrets of a stored trekking, or nil if it isn't encrypted.
+func sealedWith(v []byte) (*sealed, error) {
+	var r struct{ Sealed *sealed }
+	err := json.Unmarshal(v, &r)
+	return r.Sealed, err
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"lootjestrekken/pkg/lootjestrekken"
+	"strings"
+	"testing"
+)
+
+func testKeys(t *testing.T, fill ...byte) *Keys {
+	secrets := make([][]byte, 0, len(fill))
+	for _, i := range fill {
+		secrets = append(secrets, bytes.Repeat([]byte{i}, KeySize))
+	}
+	keys, err := NewKeys(secrets...)
+	assert.NoError(t, err)
+	return keys
+}
+
+// raw returns what is stored under key in the bucket of a trekking.
+func raw(t *testing.T, s *DbStore, name string, key []byte) []byte {
+	var v []byte
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		v = append(v, tx.Bucket([]byte(BucketName)).Bucket([]byte(name)).Get(key)...)
+		return nil
+	})
+	assert.NoError(t, err)
+	return v
+}
+
+// rawParticipants returns the participants as they are stored in the bucket of a trekking.
+func rawParticipants(t *testing.T, s *DbStore, name string) []string {
+	var res []string
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BucketName)).Bucket([]byte(name)).Bucket(participantsBucket).ForEach(func(k, v []byte) error {
+			res = append(res, string(v))
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	return res
+}
+
+func TestEncryption(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.db"
+	s, err := OpenDbStore(path, nil, testKeys(t, 1))
+	assert.NoError(t, err)
+
+	trekking := lootjestrekken.Trekking{}
+	for _, i := range []string{"jan", "piet"} {
+		_, err := trekking.AddPerson(i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, trekking.SetEmail("jan", "jan@example.com"))
+	assert.NoError(t, trekking.TrekWith(lootjestrekken.DefaultRandomness))
+	assert.NoError(t, s.AddTrekking("a", trekking))
+
+	people := rawParticipants(t, s, "a")
+	assert.Len(t, people, 2)
+	assert.NotContains(t, strings.Join(people, "\n"), "jan@example.com")
+	assert.Contains(t, strings.Join(people, "\n"), "piet")
+	stored := raw(t, s, "a", assignmentsKey)
+	assert.Contains(t, string(stored), `"Sealed"`)
+	assert.NotContains(t, string(stored), `"PeopleMapping"`)
+
+	res, err := s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, trekking.People, res.People)
+	assert.Equal(t, trekking.PeopleMapping, res.PeopleMapping)
+	assert.NoError(t, s.Db.Close())
+
+	// without the key the trekking can be listed, but not read or changed
+	s, err = OpenDbStore(path, nil, nil)
+	assert.NoError(t, err)
+	names, err := s.GetTrekkingNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, names)
+	infos, err := s.GetTrekkingInfos()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	_, err = s.GetTrekking("a")
+	assert.True(t, errors.Is(err, ErrEncrypted))
+	err = s.Modify("a", func(trekking *lootjestrekken.Trekking) error { return nil })
+	assert.True(t, errors.Is(err, ErrEncrypted))
+	assert.NoError(t, s.Db.Close())
+
+	// a trekking encrypted for another name can't be passed off as this one
+	s, err = OpenDbStore(path, nil, testKeys(t, 1))
+	assert.NoError(t, err)
+	assert.NoError(t, s.AddTrekking("b", lootjestrekken.Trekking{}))
+	err = s.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BucketName)).Bucket([]byte("b")).Put(assignmentsKey, stored)
+	})
+	assert.NoError(t, err)
+	_, err = s.GetTrekking("b")
+	assert.Error(t, err)
+	assert.NoError(t, s.Db.Update(func(tx *bolt.Tx) error { return tx.Bucket([]byte(BucketName)).DeleteBucket([]byte("b")) }))
+	assert.NoError(t, s.Db.Close())
+}
+
+func TestKeyRotation(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.db"
+
+	// trekkingen from before encryption are encrypted when a key is configured
+	s, err := OpenDbStore(path, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	assert.NoError(t, s.Db.Close())
+
+	s, err = OpenDbStore(path, nil, testKeys(t, 1))
+	assert.NoError(t, err)
+	sealed, err := sealedWith(raw(t, s, "a", metaKey))
+	if assert.NoError(t, err) && assert.NotNil(t, sealed) {
+		assert.Equal(t, testKeys(t, 1).current(), sealed.Key)
+	}
+	assert.NoError(t, s.Db.Close())
+
+	// the new key goes first, the old one is still needed to decrypt
+	s, err = OpenDbStore(path, nil, testKeys(t, 2, 1))
+	assert.NoError(t, err)
+	sealed, err = sealedWith(raw(t, s, "a", metaKey))
+	if assert.NoError(t, err) && assert.NotNil(t, sealed) {
+		assert.Equal(t, testKeys(t, 2).current(), sealed.Key)
+	}
+	assert.NoError(t, s.Db.Close())
+
+	// after that the old key isn't needed anymore, and doesn't work anymore
+	s, err = OpenDbStore(path, nil, testKeys(t, 2))
+	assert.NoError(t, err)
+	_, err = s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Db.Close())
+
+	_, err = OpenDbStore(path, nil, testKeys(t, 1))
+	assert.True(t, errors.Is(err, ErrEncrypted))
+}
+
+func TestReadKeyFile(t *testing.T) {
+	path := t.TempDir() + "/key"
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(key+"\n\n"+key+"\n"), 0600))
+	keys, err := ReadKeyFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, keys.keys, 2)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("c2hvcnQ=\n"), 0600))
+	_, err = ReadKeyFile(path)
+	assert.Error(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(""), 0600))
+	_, err = ReadKeyFile(path)
+	assert.Error(t, err)
+
+	_, err = Open("bolt://" + t.TempDir() + "/lootjestrekken.db?keyfile=" + path)
+	assert.Error(t, err)
+}
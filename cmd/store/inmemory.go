@@ -1,15 +1,24 @@
 package store
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"lootjestrekken/pkg/lootjestrekken"
+	"net/url"
+	"sort"
 	"sync"
+	"time"
 )
 
 type InMemoryStore struct {
 	trekkingen map[string]lootjestrekken.Trekking
+	trash      map[string]lootjestrekken.Trekking
 	sync.Mutex
+	watchers
+	// snapshots keeps the store in a file, see OpenSnapshotStore. Without it, everything is lost when
+	// the store goes away.
+	snapshots *snapshots
 }
 
 func (i *InMemoryStore) UpdateTrekking(trekking lootjestrekken.Trekking) error {
@@ -18,7 +27,75 @@ func (i *InMemoryStore) UpdateTrekking(trekking lootjestrekken.Trekking) error {
 
 	log.Debugf("updating trekking with name %s in store", trekking.Name)
 
+	current, ok := i.trekkingen[trekking.Name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if current.Version != trekking.Version {
+		return ErrConflict
+	}
+
+	trekking, err := copyTrekking(trekking)
+	if err != nil {
+		return err
+	}
+
+	trekking.Version++
+	trekking.UpdatedAt = time.Now()
 	i.trekkingen[trekking.Name] = trekking
+	i.publish(changes(&current, &trekking)...)
+	return nil
+}
+
+// copyTrekking returns a copy of a trekking that shares no slices or maps with it.
+func copyTrekking(trekking lootjestrekken.Trekking) (lootjestrekken.Trekking, error) {
+	var res lootjestrekken.Trekking
+	jsont, err := json.Marshal(trekking)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.Unmarshal(jsont, &res)
+	return res, err
+}
+
+// sortedKeys returns the names of the trekkingen, sorted like the other stores sort them.
+func sortedKeys(trekkingen map[string]lootjestrekken.Trekking) []string {
+	keys := make([]string, 0, len(trekkingen))
+	for k := range trekkingen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (i *InMemoryStore) Modify(name string, change func(trekking *lootjestrekken.Trekking) error) error {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("modifying trekking with name %s in store", name)
+
+	current, ok := i.trekkingen[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	// change works on a copy, so a change that fails halfway leaves nothing behind
+	trekking, err := copyTrekking(current)
+	if err != nil {
+		return err
+	}
+
+	if err := change(&trekking); err != nil {
+		return err
+	}
+
+	trekking.Name = name
+	trekking.Version = current.Version + 1
+	trekking.UpdatedAt = time.Now()
+	i.trekkingen[name] = trekking
+	i.publish(changes(&current, &trekking)...)
 	return nil
 }
 
@@ -30,10 +107,10 @@ func (i *InMemoryStore) GetTrekking(name string) (lootjestrekken.Trekking, error
 
 	res, ok := i.trekkingen[name]
 	if !ok {
-		return lootjestrekken.Trekking{}, errors.New("trekking name not found")
+		return lootjestrekken.Trekking{}, ErrNotFound
 	}
 
-	return res, nil
+	return copyTrekking(res)
 }
 
 func (i *InMemoryStore) GetTrekkingNames() ([]string, error) {
@@ -42,11 +119,7 @@ func (i *InMemoryStore) GetTrekkingNames() ([]string, error) {
 
 	log.Debug("getting all trekking names from store")
 
-	keys := make([]string, 0, len(i.trekkingen))
-	for k := range i.trekkingen {
-		keys = append(keys, k)
-	}
-	return keys, nil
+	return sortedKeys(i.trekkingen), nil
 }
 
 func (i *InMemoryStore) GetTrekkingInfos() ([]string, error) {
@@ -55,11 +128,12 @@ func (i *InMemoryStore) GetTrekkingInfos() ([]string, error) {
 
 	log.Debug("getting all trekking infos from store")
 
-	keys := make([]string, 0, len(i.trekkingen))
-	for _, v := range i.trekkingen {
-		keys = append(keys, v.GetInfo())
+	infos := make([]string, 0, len(i.trekkingen))
+	for _, k := range sortedKeys(i.trekkingen) {
+		trekking := i.trekkingen[k]
+		infos = append(infos, trekking.GetInfo())
 	}
-	return keys, nil
+	return infos, nil
 }
 
 func (i *InMemoryStore) AddTrekking(name string, trekking lootjestrekken.Trekking) error {
@@ -74,7 +148,160 @@ func (i *InMemoryStore) AddTrekking(name string, trekking lootjestrekken.Trekkin
 		return ErrExists
 	}
 
+	trekking, err := copyTrekking(trekking)
+	if err != nil {
+		return err
+	}
+
+	trekking.CreatedAt = time.Now()
+	trekking.UpdatedAt = trekking.CreatedAt
+
+	i.trekkingen[name] = trekking
+	i.publish(changes(nil, &trekking)...)
+
+	return nil
+}
+
+func (i *InMemoryStore) DeleteTrekking(name string, check func(trekking lootjestrekken.Trekking) error) error {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("Deleting trekking with name %s from store", name)
+
+	trekking, ok := i.trekkingen[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := checked(check, trekking); err != nil {
+		return err
+	}
+
+	if _, ok := i.trash[name]; ok {
+		return ErrExists
+	}
+
+	trekking.Trash(time.Now())
+	i.trash[name] = trekking
+	delete(i.trekkingen, name)
+	i.publish(changes(&trekking, nil)...)
+	return nil
+}
+
+func (i *InMemoryStore) RenameTrekking(name, newname string, check func(trekking lootjestrekken.Trekking) error) error {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("Renaming trekking with name %s to %s in store", name, newname)
+
+	trekking, ok := i.trekkingen[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := checked(check, trekking); err != nil {
+		return err
+	}
+
+	if _, ok := i.trekkingen[newname]; ok {
+		return ErrExists
+	}
+
+	old := trekking
+	trekking.Name = newname
+	trekking.Version++
+	trekking.UpdatedAt = time.Now()
+	i.trekkingen[newname] = trekking
+	delete(i.trekkingen, name)
+	i.publish(append(changes(&old, nil), changes(nil, &trekking)...)...)
+
+	return nil
+}
+
+func (i *InMemoryStore) CloneTrekking(name, newname string) error {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("Cloning trekking with name %s to %s in store", name, newname)
+
+	trekking, ok := i.trekkingen[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := i.trekkingen[newname]; ok {
+		return ErrExists
+	}
+
+	clone := trekking.Clone()
+	clone.Name = newname
+	clone.CreatedAt = time.Now()
+	clone.UpdatedAt = clone.CreatedAt
+	i.trekkingen[newname] = clone
+	i.publish(changes(nil, &clone)...)
+
+	return nil
+}
+
+func (i *InMemoryStore) GetTrashNames() ([]string, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debug("getting all trashed trekking names from store")
+
+	return sortedKeys(i.trash), nil
+}
+
+func (i *InMemoryStore) GetTrashedTrekking(name string) (lootjestrekken.Trekking, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("getting trashed trekking with name %s from store", name)
+
+	res, ok := i.trash[name]
+	if !ok {
+		return lootjestrekken.Trekking{}, ErrNotFound
+	}
+
+	return copyTrekking(res)
+}
+
+func (i *InMemoryStore) RestoreTrekking(name string) error {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("Restoring trekking with name %s in store", name)
+
+	trekking, ok := i.trash[name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := i.trekkingen[name]; ok {
+		return ErrExists
+	}
+
+	trekking.Restore()
+	trekking.Version++
+	trekking.UpdatedAt = time.Now()
 	i.trekkingen[name] = trekking
+	delete(i.trash, name)
+	i.publish(changes(nil, &trekking)...)
+
+	return nil
+}
+
+func (i *InMemoryStore) PurgeTrash(before time.Time) error {
+	i.Lock()
+	defer i.Unlock()
+
+	log.Debugf("Purging trekkingen trashed before %s from store", before)
+
+	for name, trekking := range i.trash {
+		if trekking.TrashedBefore(before) {
+			delete(i.trash, name)
+		}
+	}
 
 	return nil
 }
@@ -82,7 +309,40 @@ func (i *InMemoryStore) AddTrekking(name string, trekking lootjestrekken.Trekkin
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore {
 		trekkingen: map[string]lootjestrekken.Trekking{},
+		trash:      map[string]lootjestrekken.Trekking{},
 	}
 }
 
+func init() {
+	// memory:// loses everything when the server stops, memory:///data/lootjes.json?interval=1m
+	// keeps snapshots in a file, see OpenSnapshotStore
+	Register("memory", func(u *url.URL) (Store, error) {
+		query, err := options(u, "interval")
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Host == "" && u.Path == "" && u.Opaque == "" {
+			if query.Get("interval") != "" {
+				return nil, fmt.Errorf("an interval needs a snapshot file, like memory:///data/lootjes.json?interval=1m")
+			}
+
+			log.Warn("The memory store loses all trekkingen when the server stops, use memory:///path/to/snapshot.json to keep them")
+			return NewInMemoryStore(), nil
+		}
 
+		path, err := filePath(u)
+		if err != nil {
+			return nil, err
+		}
+
+		interval := time.Minute
+		if i := query.Get("interval"); i != "" {
+			if interval, err = time.ParseDuration(i); err != nil || interval < 0 {
+				return nil, fmt.Errorf("invalid interval: %s", i)
+			}
+		}
+
+		return OpenSnapshotStore(path, interval)
+	})
+}
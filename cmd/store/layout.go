@@ -0,0 +1,306 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	bolt "go.etcd.io/bbolt"
+	"lootjestrekken/pkg/lootjestrekken"
+	"reflect"
+)
+
+// Every trekking has a bucket of its own in the trekkingen or trash bucket, holding its metadata,
+// its participants and its draw under separate keys. The index bucket holds what is needed to list
+// the trekkingen that aren't in the trash.
+
+const IndexBucketName = "index"
+
+var (
+	metaKey            = []byte("meta")
+	participantsBucket = []byte("participants")
+	assignmentsKey     = []byte("assignments")
+)
+
+// indexEntry is what the index bucket keeps of a trekking.
+type indexEntry struct {
+	Getrokken bool
+}
+
+// storedParticipant is a participant as it is stored, with the hash of their token. With keys their
+// contact data is sealed.
+type storedParticipant struct {
+	ID         string
+	Name       string
+	Email      string            `json:",omitempty"`
+	Attributes map[string]string `json:",omitempty"`
+	Token      string            `json:",omitempty"`
+	Sealed     *sealed           `json:",omitempty"`
+}
+
+// storedAssignments is the draw of a trekking as it is stored. With keys it is sealed.
+type storedAssignments struct {
+	PeopleMapping []string `json:",omitempty"`
+	Sealed        *sealed  `json:",omitempty"`
+}
+
+func participantAAD(name, id string) string {
+	return name + "/participants/" + id
+}
+
+func assignmentsAAD(name string) string {
+	return name + "/assignments"
+}
+
+// meta returns the trekking without the parts that are stored under their own keys.
+func meta(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+	trekking.People = nil
+	trekking.PeopleMapping = nil
+	trekking.Tokens = nil
+	return trekking
+}
+
+func putMeta(keys *Keys, tb *bolt.Bucket, trekking lootjestrekken.Trekking) error {
+	v, err := keys.encode(meta(trekking))
+	if err != nil {
+		return err
+	}
+	return tb.Put(metaKey, v)
+}
+
+// getMeta reads the trekking in tb without its participants, draw and tokens.
+func getMeta(keys *Keys, tb *bolt.Bucket) (lootjestrekken.Trekking, error) {
+	return keys.decode(tb.Get(metaKey))
+}
+
+// putParticipants adds people after the participants that are already stored in tb.
+func putParticipants(keys *Keys, tb *bolt.Bucket, name string, people []lootjestrekken.Participant, tokens map[string]string) error {
+	pb, err := tb.CreateBucketIfNotExists(participantsBucket)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range people {
+		p := storedParticipant{ID: i.ID, Name: i.Name, Token: tokens[i.ID]}
+		if keys == nil {
+			p.Email = i.Email
+			p.Attributes = i.Attributes
+		} else if p.Sealed, err = keys.seal(contact{Email: i.Email, Attributes: i.Attributes}, participantAAD(name, i.ID)); err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+
+		// the keys keep the participants in the order they were added, the draw depends on it
+		seq, err := pb.NextSequence()
+		if err != nil {
+			return err
+		}
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, seq)
+
+		if err := pb.Put(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getParticipants(keys *Keys, tb *bolt.Bucket, name string) ([]lootjestrekken.Participant, map[string]string, error) {
+	pb := tb.Bucket(participantsBucket)
+	if pb == nil {
+		return nil, nil, nil
+	}
+
+	var people []lootjestrekken.Participant
+	var tokens map[string]string
+	err := pb.ForEach(func(k, v []byte) error {
+		var p storedParticipant
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+
+		participant := lootjestrekken.Participant{ID: p.ID, Name: p.Name, Email: p.Email, Attributes: p.Attributes}
+		if p.Sealed != nil {
+			var c contact
+			if err := keys.open(p.Sealed, participantAAD(name, p.ID), &c); err != nil {
+				return err
+			}
+			participant.Email = c.Email
+			participant.Attributes = c.Attributes
+		}
+		people = append(people, participant)
+
+		if p.Token != "" {
+			if tokens == nil {
+				tokens = map[string]string{}
+			}
+			tokens[p.ID] = p.Token
+		}
+		return nil
+	})
+	return people, tokens, err
+}
+
+func putAssignments(keys *Keys, tb *bolt.Bucket, name string, mapping []string) error {
+	if len(mapping) == 0 {
+		return tb.Delete(assignmentsKey)
+	}
+
+	a := storedAssignments{PeopleMapping: mapping}
+	if keys != nil {
+		sealed, err := keys.seal(mapping, assignmentsAAD(name))
+		if err != nil {
+			return err
+		}
+		a = storedAssignments{Sealed: sealed}
+	}
+
+	v, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return tb.Put(assignmentsKey, v)
+}
+
+func getAssignments(keys *Keys, tb *bolt.Bucket, name string) ([]string, error) {
+	v := tb.Get(assignmentsKey)
+	if v == nil {
+		return nil, nil
+	}
+
+	var a storedAssignments
+	if err := json.Unmarshal(v, &a); err != nil {
+		return nil, err
+	}
+
+	if a.Sealed == nil {
+		return a.PeopleMapping, nil
+	}
+
+	var mapping []string
+	err := keys.open(a.Sealed, assignmentsAAD(name), &mapping)
+	return mapping, err
+}
+
+// whole reports whether tb holds a trekking that is stored whole under the meta key, like it was
+// before schema version 2. Migration 2 moves trekkingen it can't decrypt as they are, they are split
+// up when they are written again with their key.
+func whole(tb *bolt.Bucket) bool {
+	return tb.Bucket(participantsBucket) == nil
+}
+
+// readTrekking reads the trekking with the given name from parent, the trekkingen or trash bucket.
+func readTrekking(keys *Keys, parent *bolt.Bucket, name string) (lootjestrekken.Trekking, error) {
+	tb := parent.Bucket([]byte(name))
+	if tb == nil {
+		return lootjestrekken.Trekking{}, ErrNotFound
+	}
+
+	t, err := getMeta(keys, tb)
+	if err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+
+	if whole(tb) {
+		t.Name = name
+		return t, nil
+	}
+
+	if t.People, t.Tokens, err = getParticipants(keys, tb, name); err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+	if t.PeopleMapping, err = getAssignments(keys, tb, name); err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+
+	t.Name = name
+	return t, nil
+}
+
+// writeTrekking stores a trekking under its name in parent, replacing whatever was stored there.
+func writeTrekking(keys *Keys, parent *bolt.Bucket, trekking lootjestrekken.Trekking) error {
+	name := []byte(trekking.Name)
+	if parent.Bucket(name) != nil {
+		if err := parent.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+
+	tb, err := parent.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+
+	if err := putMeta(keys, tb, trekking); err != nil {
+		return err
+	}
+	if err := putParticipants(keys, tb, trekking.Name, trekking.People, trekking.Tokens); err != nil {
+		return err
+	}
+	return putAssignments(keys, tb, trekking.Name, trekking.PeopleMapping)
+}
+
+// updateTrekking stores the changes from old to trekking. Participants that were only added are
+// stored after the others, any other change to the participants stores all of them again.
+func updateTrekking(keys *Keys, parent *bolt.Bucket, old, trekking lootjestrekken.Trekking) error {
+	tb := parent.Bucket([]byte(trekking.Name))
+	if tb == nil {
+		return ErrNotFound
+	}
+
+	if whole(tb) {
+		return writeTrekking(keys, parent, trekking)
+	}
+
+	if err := putMeta(keys, tb, trekking); err != nil {
+		return err
+	}
+
+	added := trekking.People
+	if samePeople(old, trekking, len(old.People)) {
+		added = trekking.People[len(old.People):]
+	} else {
+		if err := tb.DeleteBucket(participantsBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	if err := putParticipants(keys, tb, trekking.Name, added, trekking.Tokens); err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(old.PeopleMapping, trekking.PeopleMapping) {
+		return nil
+	}
+	return putAssignments(keys, tb, trekking.Name, trekking.PeopleMapping)
+}
+
+// samePeople reports whether the first n participants of both trekkingen, and their tokens, are the
+// same.
+func samePeople(a, b lootjestrekken.Trekking, n int) bool {
+	if len(a.People) < n || len(b.People) < n {
+		return false
+	}
+
+	for index := 0; index < n; index++ {
+		id := a.People[index].ID
+		if !reflect.DeepEqual(a.People[index], b.People[index]) || a.Tokens[id] != b.Tokens[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// putIndex keeps the index of a trekking up to date.
+func putIndex(tx *bolt.Tx, trekking lootjestrekken.Trekking) error {
+	v, err := json.Marshal(indexEntry{Getrokken: trekking.Getrokken})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(IndexBucketName)).Put([]byte(trekking.Name), v)
+}
+
+func deleteIndex(tx *bolt.Tx, name string) error {
+	return tx.Bucket([]byte(IndexBucketName)).Delete([]byte(name))
+}
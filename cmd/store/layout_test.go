@@ -0,0 +1,188 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"lootjestrekken/pkg/lootjestrekken"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	s, err := OpenDbStore(t.TempDir()+"/lootjestrekken.db", nil, testKeys(t, 1))
+	assert.NoError(t, err)
+	defer s.Db.Close()
+
+	trekking := lootjestrekken.Trekking{}
+	for _, i := range []string{"jan", "piet"} {
+		_, err := trekking.AddPerson(i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.AddTrekking("a", trekking))
+
+	var person lootjestrekken.Participant
+	var token string
+	err = s.Append("a", func(trekking *lootjestrekken.Trekking) error {
+		// the people that are already there aren't read
+		assert.Empty(t, trekking.People)
+
+		var err error
+		if person, err = trekking.AddParticipant(lootjestrekken.Participant{Name: "klaas", Email: "klaas@example.com"}); err != nil {
+			return err
+		}
+		token, err = trekking.IssueToken(person.ID)
+		return err
+	})
+	assert.NoError(t, err)
+
+	res, err := s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jan", "piet", "klaas"}, res.Names())
+	assert.Equal(t, person, res.People[2])
+	assert.True(t, res.CheckToken(person.ID, token))
+	assert.Equal(t, uint64(1), res.Version)
+
+	err = s.Append("a", func(trekking *lootjestrekken.Trekking) error {
+		_, err := trekking.AddPerson("marie")
+		assert.NoError(t, err)
+		return errors.New("changed my mind")
+	})
+	assert.Error(t, err)
+	res, err = s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Len(t, res.People, 3)
+
+	assert.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error { return trekking.Trek() }))
+	err = s.Append("a", func(trekking *lootjestrekken.Trekking) error {
+		_, err := trekking.AddPerson("marie")
+		return err
+	})
+	assert.Equal(t, lootjestrekken.ErrAlreadyDrawn, err)
+
+	err = s.Append("b", func(trekking *lootjestrekken.Trekking) error { return nil })
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestModifyWritesChanges(t *testing.T) {
+	s, err := OpenDbStore(t.TempDir()+"/lootjestrekken.db", nil, nil)
+	assert.NoError(t, err)
+	defer s.Db.Close()
+
+	trekking := lootjestrekken.Trekking{}
+	for _, i := range []string{"jan", "piet", "klaas"} {
+		_, err := trekking.AddPerson(i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.AddTrekking("a", trekking))
+	before := rawParticipants(t, s, "a")
+
+	// adding someone leaves the others as they were
+	assert.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		_, err := trekking.AddPerson("marie")
+		return err
+	}))
+	assert.Equal(t, before, rawParticipants(t, s, "a")[:3])
+
+	// removing someone stores everyone else again
+	assert.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		return trekking.RemovePerson("piet")
+	}))
+	res, err := s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jan", "klaas", "marie"}, res.Names())
+	assert.Len(t, rawParticipants(t, s, "a"), 3)
+}
+
+func TestIndex(t *testing.T) {
+	s, err := OpenDbStore(t.TempDir()+"/lootjestrekken.db", nil, nil)
+	assert.NoError(t, err)
+	defer s.Db.Close()
+
+	index := func() map[string]string {
+		res := map[string]string{}
+		err := s.Db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(IndexBucketName)).ForEach(func(k, v []byte) error {
+				res[string(k)] = string(v)
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+		return res
+	}
+
+	trekking := lootjestrekken.Trekking{}
+	for _, i := range []string{"jan", "piet"} {
+		_, err := trekking.AddPerson(i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.AddTrekking("a", trekking))
+	assert.NoError(t, s.CloneTrekking("a", "b"))
+	assert.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error { return trekking.Trek() }))
+	assert.Equal(t, map[string]string{"a": `{"Getrokken":true}`, "b": `{"Getrokken":false}`}, index())
+
+	assert.NoError(t, s.RenameTrekking("b", "c", nil))
+	assert.NoError(t, s.DeleteTrekking("a", nil))
+	assert.Equal(t, map[string]string{"c": `{"Getrokken":false}`}, index())
+
+	assert.NoError(t, s.RestoreTrekking("a"))
+	assert.Equal(t, map[string]string{"a": `{"Getrokken":true}`, "c": `{"Getrokken":false}`}, index())
+}
+
+func TestMigrateEncryptedBuckets(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.db"
+	keys := testKeys(t, 1)
+
+	// a database of schema version 1, with an encrypted trekking as a single value
+	trekking := lootjestrekken.Trekking{Name: "a"}
+	_, err := trekking.AddParticipant(lootjestrekken.Participant{Name: "jan", Email: "jan@example.com"})
+	assert.NoError(t, err)
+	v, err := keys.encode(trekking)
+	assert.NoError(t, err)
+
+	db, err := bolt.Open(path, 0666, nil)
+	assert.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, i := range []string{MetaBucketName, BucketName, TrashBucketName} {
+			if _, err := tx.CreateBucket([]byte(i)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket([]byte(MetaBucketName)).Put(schemaKey, []byte("1")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BucketName)).Put([]byte("a"), v)
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	// without the key it is moved as it is, and can still be listed
+	report, err := DryRunMigrations("bolt://" + path)
+	assert.NoError(t, err)
+	assert.Contains(t, report, "trekking a: moved to a bucket of its own without its key, it is split up once it is changed with the key")
+
+	s, err := OpenDbStore(path, nil, nil)
+	assert.NoError(t, err)
+	infos, err := s.GetTrekkingInfos()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, infos)
+	_, err = s.GetTrekking("a")
+	assert.True(t, errors.Is(err, ErrEncrypted))
+	assert.NoError(t, s.Db.Close())
+
+	s, err = OpenDbStore(path, nil, keys)
+	assert.NoError(t, err)
+	defer s.Db.Close()
+	res, err := s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, trekking.People, res.People)
+
+	// a change with the key splits it up
+	assert.NoError(t, s.Append("a", func(trekking *lootjestrekken.Trekking) error {
+		_, err := trekking.AddPerson("piet")
+		return err
+	}))
+	res, err = s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jan", "piet"}, res.Names())
+	assert.Len(t, rawParticipants(t, s, "a"), 2)
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package store
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile waits for an advisory lock on f, which other processes that lock the same file respect.
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return syscall.Flock(int(f.Fd()), how)
+}
+
+// tryLockFile takes an exclusive lock on f like lockFile, or returns ErrLocked if someone else has a
+// lock on it.
+func tryLockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// lockFile waits for a lock on all of f, which other processes that lock the same file respect.
+func lockFile(f *os.File, exclusive bool) error {
+	var flags uintptr
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 0xffffffff, 0xffffffff, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// tryLockFile takes an exclusive lock on f like lockFile, or returns ErrLocked if someone else has a
+// lock on it.
+func tryLockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 0xffffffff, 0xffffffff, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		if err == errorLockViolation {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 0xffffffff, 0xffffffff, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/url"
+	"strconv"
+)
+
+// SchemaVersion is the version of the layout of the bolt database that this version writes.
+const SchemaVersion = 2
+
+// MetaBucketName is the bucket with information about the database itself, like its schema version.
+const MetaBucketName = "meta"
+
+var schemaKey = []byte("schema")
+
+var ErrNewerSchema = errors.New("database was written by a newer version of lootjestrekken")
+
+var errDryRun = errors.New("dry run")
+
+// migration upgrades a database from the version before it to its version. It reports every change
+// it makes with report. It gets the keys of the store, if any, for migrations that need to decrypt.
+type migration struct {
+	version     int
+	description string
+	migrate     func(tx *bolt.Tx, keys *Keys, report func(format string, args ...interface{})) error
+}
+
+// migrations are run in order on a database with an older schema version. A migration works on the
+// stored json rather than on lootjestrekken.Trekking, so it keeps working when Trekking changes.
+var migrations = []migration{
+	{1, "give every person an id", migratePeopleIDs},
+	{2, "store every trekking in a bucket of its own", migrateBuckets},
+}
+
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	v := tx.Bucket([]byte(MetaBucketName)).Get(schemaKey)
+	if v == nil {
+		// databases from before the schema version have version 0
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", v, err)
+	}
+	return version, nil
+}
+
+// migrate brings the database up to SchemaVersion. A database of a newer version is refused.
+func migrate(tx *bolt.Tx, keys *Keys, report func(format string, args ...interface{})) error {
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: it has schema version %d, this version supports up to %d", ErrNewerSchema, version, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		report("migration %d: %s", m.version, m.description)
+		if err := m.migrate(tx, keys, report); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		version = m.version
+	}
+
+	return tx.Bucket([]byte(MetaBucketName)).Put(schemaKey, []byte(strconv.Itoa(version)))
+}
+
+// createBuckets makes sure the buckets of the current schema exist.
+func createBuckets(tx *bolt.Tx) error {
+	for _, name := range []string{MetaBucketName, BucketName, TrashBucketName, IndexBucketName} {
+		_, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+	}
+	return nil
+}
+
+// DryRunMigrations reports what opening the store at rawurl would migrate, without changing it.
+func DryRunMigrations(rawurl string) ([]string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "bolt" {
+		return nil, fmt.Errorf("%s stores have no migrations", u.Scheme)
+	}
+
+	path, opts, keys, err := boltURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists(path) {
+		return nil, fmt.Errorf("database %s does not exist", path)
+	}
+
+	db, err := bolt.Open(path, 0666, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	report := make([]string, 0)
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := createBuckets(tx); err != nil {
+			return err
+		}
+
+		err := migrate(tx, keys, func(format string, args ...interface{}) {
+			report = append(report, fmt.Sprintf(format, args...))
+		})
+		if err != nil {
+			return err
+		}
+
+		// returning an error rolls back everything the migrations did
+		return errDryRun
+	})
+	if err != errDryRun {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// logMigration logs the changes of migrations while opening a store.
+func logMigration(format string, args ...interface{}) {
+	log.Infof(format, args...)
+}
+
+// changeRecords calls change for every stored trekking, in the store and in the trash, and stores
+// what it returns if it is different. change gets and returns the decoded json object.
+func changeRecords(tx *bolt.Tx, change func(name string, record map[string]json.RawMessage) (bool, error)) error {
+	for _, bucket := range []string{BucketName, TrashBucketName} {
+		b := tx.Bucket([]byte(bucket))
+
+		// bolt doesn't allow changing a bucket while iterating with ForEach
+		changed := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				// a nested bucket, records of older schemas are plain values
+				return nil
+			}
+
+			var record map[string]json.RawMessage
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("trekking %s: %w", k, err)
+			}
+
+			ok, err := change(string(k), record)
+			if err != nil || !ok {
+				return err
+			}
+
+			encoded, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			changed[string(k)] = encoded
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, v := range changed {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// migratePeopleIDs turns people that are stored as plain names into participants, with their name as
+// id.
+func migratePeopleIDs(tx *bolt.Tx, keys *Keys, report func(format string, args ...interface{})) error {
+	return changeRecords(tx, func(name string, record map[string]json.RawMessage) (bool, error) {
+		var names []string
+		if err := json.Unmarshal(record["People"], &names); err != nil || len(names) == 0 {
+			// no people, or people that already are participants
+			return false, nil
+		}
+
+		people := make([]map[string]string, 0, len(names))
+		for _, i := range names {
+			people = append(people, map[string]string{"ID": i, "Name": i})
+		}
+
+		encoded, err := json.Marshal(people)
+		if err != nil {
+			return false, err
+		}
+
+		record["People"] = encoded
+		report("trekking %s: gave %d people an id", name, len(names))
+		return true, nil
+	})
+}
+
+// migrateBuckets moves every trekking from a single value into a bucket of its own, see layout.go, and
+// indexes the ones that aren't in the trash. Encrypted trekkingen need the keys of the store.
+func migrateBuckets(tx *bolt.Tx, keys *Keys, report func(format string, args ...interface{})) error {
+	// record is a trekking as it was stored, for one that is encrypted with a key that isn't there
+	type move struct {
+		trekking lootjestrekken.Trekking
+		record   []byte
+	}
+
+	for _, bucket := range []string{BucketName, TrashBucketName} {
+		b := tx.Bucket([]byte(bucket))
+
+		// bolt doesn't allow changing a bucket while iterating with ForEach
+		var moved []move
+		err := b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+
+			t, err := keys.decode(v)
+			var record []byte
+			if errors.Is(err, ErrEncrypted) {
+				// without its key the trekking is moved as it is, its public part is enough for the index
+				t, err = decodePublic(v)
+				record = append([]byte(nil), v...)
+			}
+			if err != nil {
+				return fmt.Errorf("trekking %s: %w", k, err)
+			}
+			t.Name = string(k)
+			moved = append(moved, move{trekking: t, record: record})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, m := range moved {
+			t := m.trekking
+			if err := b.Delete([]byte(t.Name)); err != nil {
+				return err
+			}
+
+			if m.record == nil {
+				if err := writeTrekking(keys, b, t); err != nil {
+					return err
+				}
+				report("trekking %s: moved to a bucket of its own", t.Name)
+			} else {
+				tb, err := b.CreateBucket([]byte(t.Name))
+				if err != nil {
+					return err
+				}
+				if err := tb.Put(metaKey, m.record); err != nil {
+					return err
+				}
+				report("trekking %s: moved to a bucket of its own without its key, it is split up once it is changed with the key", t.Name)
+			}
+
+			if bucket == BucketName {
+				if err := putIndex(tx, t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
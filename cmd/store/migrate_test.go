@@ -0,0 +1,89 @@
+package store
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"testing"
+)
+
+// legacyDb writes a database from before the schema version, with people as plain names.
+func legacyDb(t *testing.T) string {
+	path := t.TempDir() + "/lootjestrekken.db"
+	db, err := bolt.Open(path, 0666, nil)
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BucketName))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("old"), []byte(`{"Name": "old", "People": ["a", "b"]}`)); err != nil {
+			return err
+		}
+		return b.Put([]byte("new"), []byte(`{"Name": "new", "People": [{"ID": "1", "Name": "c"}]}`))
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	return path
+}
+
+func TestMigrations(t *testing.T) {
+	path := legacyDb(t)
+
+	report, err := DryRunMigrations("bolt://" + path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"migration 1: give every person an id",
+		"trekking old: gave 2 people an id",
+		"migration 2: store every trekking in a bucket of its own",
+		"trekking new: moved to a bucket of its own",
+		"trekking old: moved to a bucket of its own",
+	}, report)
+
+	// the dry run didn't change anything
+	report, err = DryRunMigrations("bolt://" + path)
+	assert.NoError(t, err)
+	assert.Len(t, report, 5)
+
+	s, err := OpenDbStore(path, nil, nil)
+	assert.NoError(t, err)
+	err = s.Db.View(func(tx *bolt.Tx) error {
+		version, err := schemaVersion(tx)
+		assert.Equal(t, SchemaVersion, version)
+		return err
+	})
+	assert.NoError(t, err)
+
+	trekking, err := s.GetTrekking("new")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, trekking.IDs())
+	assert.NoError(t, s.Db.Close())
+
+	report, err = DryRunMigrations("bolt://" + path)
+	assert.NoError(t, err)
+	assert.Empty(t, report)
+}
+
+func TestNewerSchema(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.db"
+	s, err := OpenDbStore(path, nil, nil)
+	assert.NoError(t, err)
+	err = s.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(MetaBucketName)).Put(schemaKey, []byte("1000"))
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Db.Close())
+
+	_, err = OpenDbStore(path, nil, nil)
+	assert.True(t, errors.Is(err, ErrNewerSchema))
+	_, err = DryRunMigrations("bolt://" + path)
+	assert.True(t, errors.Is(err, ErrNewerSchema))
+}
+
+func TestDryRunMigrationsNeedsDatabase(t *testing.T) {
+	_, err := DryRunMigrations("bolt://" + t.TempDir() + "/missing.db")
+	assert.Error(t, err)
+	_, err = DryRunMigrations("memory://")
+	assert.Error(t, err)
+}
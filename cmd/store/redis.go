@@ -0,0 +1,464 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// DefaultRedisPrefix is put before all keys of a RedisStore, unless it is given another prefix.
+const DefaultRedisPrefix = "lootjestrekken:"
+
+// RedisStore keeps trekkingen in Redis, so that several servers can share them. Every trekking is a
+// json value under a key of its own, prefix + "trekking:" + name, or prefix + "trash:" + name once it
+// is in the trash. Next to those, prefix + "index" is a hash from names to what listing trekkingen
+// needs, like the index of DbStore, and prefix + "trashed" is the set of names in the trash.
+//
+// Changes read and write in a WATCH/MULTI transaction, which is tried again when another server
+// changed the same keys in between, up to maxRetries times before it fails with ErrConflict.
+//
+// Watch and WatchAll only see the changes made through this RedisStore, not those of other servers
+// that share the same Redis.
+type RedisStore struct {
+	Client *redis.Client
+	Prefix string
+	watchers
+}
+
+func (i *RedisStore) trekkingKey(name string) string {
+	return i.Prefix + "trekking:" + name
+}
+
+func (i *RedisStore) trashKey(name string) string {
+	return i.Prefix + "trash:" + name
+}
+
+func (i *RedisStore) indexKey() string {
+	return i.Prefix + "index"
+}
+
+func (i *RedisStore) trashedKey() string {
+	return i.Prefix + "trashed"
+}
+
+// transaction runs fn with keys watched. When one of them changes before the changes of fn are
+// stored it runs fn again, at most maxRetries times, otherwise it publishes the events fn returns.
+func (i *RedisStore) transaction(fn func(ctx context.Context, tx *redis.Tx) ([]Event, error), keys ...string) error {
+	ctx := context.Background()
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		var events []Event
+		err := i.Client.Watch(ctx, func(tx *redis.Tx) error {
+			var err error
+			events, err = fn(ctx, tx)
+			return err
+		}, keys...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		i.publish(events...)
+		return nil
+	}
+
+	return ErrConflict
+}
+
+// fetch reads the trekking stored under key.
+func fetch(ctx context.Context, c redis.Cmdable, key string) (lootjestrekken.Trekking, error) {
+	v, err := c.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return lootjestrekken.Trekking{}, ErrNotFound
+	}
+	if err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+
+	var t lootjestrekken.Trekking
+	err = json.Unmarshal(v, &t)
+	return t, err
+}
+
+// put stores a trekking that isn't in the trash, with its index entry.
+func (i *RedisStore) put(ctx context.Context, pipe redis.Pipeliner, trekking lootjestrekken.Trekking) error {
+	v, err := json.Marshal(trekking)
+	if err != nil {
+		return err
+	}
+	entry, err := json.Marshal(indexEntry{Getrokken: trekking.Getrokken})
+	if err != nil {
+		return err
+	}
+
+	pipe.Set(ctx, i.trekkingKey(trekking.Name), v, 0)
+	pipe.HSet(ctx, i.indexKey(), trekking.Name, entry)
+	return nil
+}
+
+// drop removes a trekking that isn't in the trash, with its index entry.
+func (i *RedisStore) drop(ctx context.Context, pipe redis.Pipeliner, name string) {
+	pipe.Del(ctx, i.trekkingKey(name))
+	pipe.HDel(ctx, i.indexKey(), name)
+}
+
+// exec runs the commands that fill queues in a MULTI/EXEC block.
+func exec(ctx context.Context, tx *redis.Tx, fill func(pipe redis.Pipeliner) error) error {
+	_, err := tx.TxPipelined(ctx, fill)
+	return err
+}
+
+func (i *RedisStore) AddTrekking(name string, trekking lootjestrekken.Trekking) error {
+	log.Debugf("Adding trekking with name %s to store", name)
+
+	trekking.Name = name
+	trekking.CreatedAt = time.Now()
+	trekking.UpdatedAt = trekking.CreatedAt
+
+	key := i.trekkingKey(name)
+	return i.transaction(func(ctx context.Context, tx *redis.Tx) ([]Event, error) {
+		n, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return nil, ErrExists
+		}
+
+		return changes(nil, &trekking), exec(ctx, tx, func(pipe redis.Pipeliner) error {
+			return i.put(ctx, pipe, trekking)
+		})
+	}, key)
+}
+
+func (i *RedisStore) GetTrekkingNames() ([]string, error) {
+	log.Debug("getting all trekking names from store")
+
+	names, err := i.Client.HKeys(context.Background(), i.indexKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (i *RedisStore) GetTrekkingInfos() ([]string, error) {
+	log.Debug("getting all trekking infos from store")
+
+	index, err := i.Client.HGetAll(context.Background(), i.indexKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(index))
+	for k := range index {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	infos := make([]string, 0, len(names))
+	for _, k := range names {
+		var entry indexEntry
+		if err := json.Unmarshal([]byte(index[k]), &entry); err != nil {
+			return nil, fmt.Errorf("index of trekking %s: %w", k, err)
+		}
+
+		t := lootjestrekken.Trekking{Name: k, Getrokken: entry.Getrokken}
+		infos = append(infos, t.GetInfo())
+	}
+	return infos, nil
+}
+
+func (i *RedisStore) GetTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trekking with name %s from store", name)
+
+	return fetch(context.Background(), i.Client, i.trekkingKey(name))
+}
+
+func (i *RedisStore) UpdateTrekking(trekking lootjestrekken.Trekking) error {
+	log.Debugf("updating trekking with name %s in store", trekking.Name)
+
+	key := i.trekkingKey(trekking.Name)
+	return i.transaction(func(ctx context.Context, tx *redis.Tx) ([]Event, error) {
+		old, err := fetch(ctx, tx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if old.Version != trekking.Version {
+			return nil, ErrConflict
+		}
+
+		t := trekking
+		t.Version++
+		t.UpdatedAt = time.Now()
+		return changes(&old, &t), exec(ctx, tx, func(pipe redis.Pipeliner) error {
+			return i.put(ctx, pipe, t)
+		})
+	}, key)
+}
+
+func (i *RedisStore) Modify(name string, change func(trekking *lootjestrekken.Trekking) error) error {
+	log.Debugf("modifying trekking with name %s in store", name)
+
+	key := i.trekkingKey(name)
+	return i.transaction(func(ctx context.Context, tx *redis.Tx) ([]Event, error) {
+		old, err := fetch(ctx, tx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := copyTrekking(old)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := change(&t); err != nil {
+			return nil, err
+		}
+
+		t.Name = name
+		t.Version = old.Version + 1
+		t.UpdatedAt = time.Now()
+		return changes(&old, &t), exec(ctx, tx, func(pipe redis.Pipeliner) error {
+			return i.put(ctx, pipe, t)
+		})
+	}, key)
+}
+
+func (i *RedisStore) DeleteTrekking(name string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Deleting trekking with name %s from store", name)
+
+	key := i.trekkingKey(name)
+	trash := i.trashKey(name)
+	return i.transaction(func(ctx context.Context, tx *redis.Tx) ([]Event, error) {
+		t, err := fetch(ctx, tx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checked(check, t); err != nil {
+			return nil, err
+		}
+
+		n, err := tx.Exists(ctx, trash).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return nil, ErrExists
+		}
+
+		t.Trash(time.Now())
+		v, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return changes(&t, nil), exec(ctx, tx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, trash, v, 0)
+			pipe.SAdd(ctx, i.trashedKey(), name)
+			i.drop(ctx, pipe, name)
+			return nil
+		})
+	}, key, trash)
+}
+
+// move stores the trekking under name, from the trash if trashed is set, as newname, changed by
+// change, in a single transaction, after check accepts it. The original is kept if keep is set.
+func (i *RedisStore) move(name string, trashed bool, newname string, check func(trekking lootjestrekken.Trekking) error, change func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking, keep bool) error {
+	from := i.trekkingKey(name)
+	if trashed {
+		from = i.trashKey(name)
+	}
+	to := i.trekkingKey(newname)
+
+	return i.transaction(func(ctx context.Context, tx *redis.Tx) ([]Event, error) {
+		old, err := fetch(ctx, tx, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checked(check, old); err != nil {
+			return nil, err
+		}
+
+		n, err := tx.Exists(ctx, to).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return nil, ErrExists
+		}
+
+		t := change(old)
+		t.Name = newname
+
+		events := changes(nil, &t)
+		if !keep && !trashed {
+			events = append(changes(&old, nil), events...)
+		}
+		return events, exec(ctx, tx, func(pipe redis.Pipeliner) error {
+			switch {
+			case keep:
+			case trashed:
+				pipe.Del(ctx, from)
+				pipe.SRem(ctx, i.trashedKey(), name)
+			default:
+				i.drop(ctx, pipe, name)
+			}
+			return i.put(ctx, pipe, t)
+		})
+	}, from, to)
+}
+
+func (i *RedisStore) RenameTrekking(name, newname string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Renaming trekking with name %s to %s in store", name, newname)
+
+	return i.move(name, false, newname, check, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *RedisStore) CloneTrekking(name, newname string) error {
+	log.Debugf("Cloning trekking with name %s to %s in store", name, newname)
+
+	return i.move(name, false, newname, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		clone := trekking.Clone()
+		clone.CreatedAt = time.Now()
+		clone.UpdatedAt = clone.CreatedAt
+		return clone
+	}, true)
+}
+
+func (i *RedisStore) GetTrashNames() ([]string, error) {
+	log.Debug("getting all trashed trekking names from store")
+
+	names, err := i.Client.SMembers(context.Background(), i.trashedKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (i *RedisStore) GetTrashedTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trashed trekking with name %s from store", name)
+
+	return fetch(context.Background(), i.Client, i.trashKey(name))
+}
+
+func (i *RedisStore) RestoreTrekking(name string) error {
+	log.Debugf("Restoring trekking with name %s in store", name)
+
+	return i.move(name, true, name, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Restore()
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *RedisStore) PurgeTrash(before time.Time) error {
+	log.Debugf("Purging trekkingen trashed before %s from store", before)
+
+	return i.transaction(func(ctx context.Context, tx *redis.Tx) ([]Event, error) {
+		names, err := tx.SMembers(ctx, i.trashedKey()).Result()
+		if err != nil || len(names) == 0 {
+			return nil, err
+		}
+
+		keys := make([]string, 0, len(names))
+		for _, k := range names {
+			keys = append(keys, i.trashKey(k))
+		}
+		if err := tx.Watch(ctx, keys...).Err(); err != nil {
+			return nil, err
+		}
+
+		var purge []string
+		for index, k := range keys {
+			t, err := fetch(ctx, tx, k)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("trashed trekking %s: %w", names[index], err)
+			}
+
+			if t.TrashedBefore(before) {
+				purge = append(purge, names[index])
+			}
+		}
+		if len(purge) == 0 {
+			return nil, nil
+		}
+
+		return nil, exec(ctx, tx, func(pipe redis.Pipeliner) error {
+			for _, k := range purge {
+				pipe.Del(ctx, i.trashKey(k))
+				pipe.SRem(ctx, i.trashedKey(), k)
+			}
+			return nil
+		})
+	}, i.trashedKey())
+}
+
+// NewRedisStore uses the Redis server of client, with prefix before all keys so that several stores
+// can share a server.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{
+		Client: client,
+		Prefix: prefix,
+	}
+}
+
+// Close closes the connections to Redis.
+func (i *RedisStore) Close() error {
+	return i.Client.Close()
+}
+
+func init() {
+	// redis://:password@localhost:6379/0?prefix=lootjestrekken:, rediss:// for tls. The other options
+	// of the url are those of redis.ParseURL, like dial_timeout=5s.
+	open := func(u *url.URL) (Store, error) {
+		query, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := DefaultRedisPrefix
+		if _, ok := query["prefix"]; ok {
+			prefix = query.Get("prefix")
+			query.Del("prefix")
+		}
+
+		rest := *u
+		rest.RawQuery = query.Encode()
+		opts, err := redis.ParseURL(rest.String())
+		if err != nil {
+			return nil, err
+		}
+
+		s := NewRedisStore(redis.NewClient(opts), prefix)
+		if err := s.Client.Ping(context.Background()).Err(); err != nil {
+			s.Client.Close()
+			return nil, fmt.Errorf("couldn't reach redis at %s: %w", opts.Addr, err)
+		}
+		return s, nil
+	}
+
+	Register("redis", open)
+	Register("rediss", open)
+}
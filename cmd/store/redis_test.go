@@ -0,0 +1,74 @@
+package store
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"lootjestrekken/pkg/lootjestrekken"
+	"testing"
+)
+
+func TestRedisKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	s, err := Open("redis://" + server.Addr() + "/0?prefix=lootjes:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.(*RedisStore).Close()
+	assert.Equal(t, "lootjes:", s.(*RedisStore).Prefix)
+
+	assert.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	assert.NoError(t, s.AddTrekking("b", lootjestrekken.Trekking{}))
+	assert.NoError(t, s.DeleteTrekking("b", nil))
+	assert.Equal(t, []string{"lootjes:index", "lootjes:trash:b", "lootjes:trashed", "lootjes:trekking:a"}, server.Keys())
+
+	fields, err := server.HKeys("lootjes:index")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, fields)
+
+	// another server that shares the database sees the same trekkingen
+	other, err := Open("redis://" + server.Addr() + "/0?prefix=lootjes:")
+	if assert.NoError(t, err) {
+		defer other.(*RedisStore).Close()
+		names, err := other.GetTrekkingNames()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a"}, names)
+	}
+
+	s, err = Open("redis://" + server.Addr())
+	if assert.NoError(t, err) {
+		defer s.(*RedisStore).Close()
+		assert.Equal(t, DefaultRedisPrefix, s.(*RedisStore).Prefix)
+	}
+
+	for _, i := range []string{
+		"redis://" + server.Addr() + "?unknown=1",
+		"redis://" + server.Addr() + "/notanumber",
+		"redis://127.0.0.1:1?dial_timeout=100ms",
+	} {
+		_, err := Open(i)
+		assert.Error(t, err, i)
+	}
+}
+
+func TestRedisConflict(t *testing.T) {
+	server := miniredis.RunT(t)
+	s, err := Open("redis://" + server.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.(*RedisStore).Close()
+	assert.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+
+	// another server that changes the trekking every time makes the change give up after a while
+	calls := 0
+	err = s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		calls++
+		v, err := server.Get(DefaultRedisPrefix + "trekking:a")
+		if err != nil {
+			return err
+		}
+		return server.Set(DefaultRedisPrefix+"trekking:a", v)
+	})
+	assert.Equal(t, ErrConflict, err)
+	assert.Equal(t, maxRetries, calls)
+}
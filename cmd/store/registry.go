@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Opener opens a store with the configuration in its URL.
+type Opener func(u *url.URL) (Store, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = map[string]Opener{}
+)
+
+// Register makes a store available under a URL scheme, so that Open can open it. Stores of other
+// packages can register themselves from an init function. Register panics if the scheme is
+// registered twice.
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if opener == nil {
+		panic("store: Register opener is nil")
+	}
+	if _, dup := openers[scheme]; dup {
+		panic("store: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// unregister removes a scheme, so that tests can register one of their own more than once.
+func unregister(scheme string) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	delete(openers, scheme)
+}
+
+// Schemes returns the registered URL schemes, sorted.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for k := range openers {
+		schemes = append(schemes, k)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open opens the store that rawurl configures, for example memory:// or bolt:///data/lootjes.db.
+func Open(rawurl string) (Store, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store url %s: %w", rawurl, err)
+	}
+
+	openersMu.RLock()
+	opener, ok := openers[u.Scheme]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store %q, use one of %v", u.Scheme, Schemes())
+	}
+
+	s, err := opener(u)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open store %s: %w", rawurl, err)
+	}
+	return s, nil
+}
+
+// filePath returns the file a URL like bolt:///data/lootjes.db or bolt:data/lootjes.db points to.
+func filePath(u *url.URL) (string, error) {
+	if u.Host != "" {
+		return "", fmt.Errorf("%s urls have no host, use %s:///absolute/path or %s:relative/path", u.Scheme, u.Scheme, u.Scheme)
+	}
+
+	path := u.Opaque
+	if path == "" {
+		path = u.Path
+	}
+	if path == "" {
+		return "", fmt.Errorf("%s url has no path", u.Scheme)
+	}
+	return path, nil
+}
+
+// options checks that a URL only has the given query parameters, and returns them.
+func options(u *url.URL, allowed ...string) (url.Values, error) {
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	for k := range query {
+		found := false
+		for _, i := range allowed {
+			found = found || k == i
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown option %s for %s store", k, u.Scheme)
+		}
+	}
+	return query, nil
+}
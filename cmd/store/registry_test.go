@@ -0,0 +1,80 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	s, err := Open("memory://")
+	assert.NoError(t, err)
+	assert.IsType(t, &InMemoryStore{}, s)
+
+	dir := t.TempDir()
+	s, err = Open("bolt://" + dir + "/lootjes.db?timeout=1s")
+	if assert.NoError(t, err) {
+		assert.IsType(t, &DbStore{}, s)
+		assert.NoError(t, s.(*DbStore).Db.Close())
+	}
+
+	s, err = Open("memory://" + dir + "/lootjes.json?interval=1m")
+	if assert.NoError(t, err) {
+		assert.IsType(t, &InMemoryStore{}, s)
+		assert.NoError(t, s.(*InMemoryStore).Close())
+	}
+
+	s, err = Open("sqlite://" + dir + "/lootjes.sqlite")
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLStore{}, s)
+
+	s, err = Open("dir://" + dir + "?format=yaml")
+	if assert.NoError(t, err) {
+		assert.IsType(t, &DirStore{}, s)
+		assert.Equal(t, "yaml", s.(*DirStore).Format)
+	}
+
+	for _, i := range []string{
+		"",
+		"db",
+		"inmemory",
+		"postgres://localhost/lootjes",
+		"memory://?timeout=1s",
+		"memory://?interval=1m",
+		"memory://" + dir + "/lootjes.json?interval=soon",
+		"memory://" + dir + "/missing/lootjes.json",
+		"bolt://",
+		"bolt://data/lootjes.db",
+		"bolt://" + dir + "/lootjes.db?timeout=soon",
+		"bolt://" + dir + "/lootjes.db?readonly=true",
+		"bolt://" + dir + "/missing/lootjes.db",
+		"dir://" + dir + "?format=toml",
+		"dir://" + dir + "/missing",
+		"dir://" + dir + "?interval=1m",
+		"%zz",
+	} {
+		_, err := Open(i)
+		assert.Error(t, err, i)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var opened *url.URL
+	Register("test", func(u *url.URL) (Store, error) {
+		opened = u
+		return NewInMemoryStore(), nil
+	})
+	t.Cleanup(func() { unregister("test") })
+
+	_, err := Open("test://host/path?option=1")
+	assert.NoError(t, err)
+	assert.Equal(t, "host", opened.Host)
+	assert.Contains(t, Schemes(), "test")
+
+	assert.Panics(t, func() {
+		Register("test", func(u *url.URL) (Store, error) { return nil, nil })
+	})
+	assert.Panics(t, func() {
+		Register("other", nil)
+	})
+}
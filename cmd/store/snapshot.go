@@ -0,0 +1,238 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"lootjestrekken/pkg/lootjestrekken"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned when a snapshot is opened that another store already has open, as they would
+// overwrite each other's snapshots.
+var ErrLocked = errors.New("the snapshot is in use by another process")
+
+// snapshots keeps an InMemoryStore in a file, in the format of Export.
+type snapshots struct {
+	path string
+	// lock is the file next to the snapshot that is locked while the store is open, the snapshot
+	// itself is replaced on every write
+	lock *os.File
+	// saved is the hash of what is in the file, so that an unchanged store doesn't write it again
+	saved [sha256.Size]byte
+	// mu makes snapshots write one at a time
+	mu   sync.Mutex
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenSnapshotStore returns an InMemoryStore with the trekkingen of the snapshot at path, or an empty
+// one if there is no snapshot yet. It writes a new snapshot every interval, if anything changed, and
+// when it is closed. An interval of 0 only writes it when the store is closed. The file path + ".lock"
+// is locked until the store is closed, and if another process has it locked, ErrLocked is returned.
+func OpenSnapshotStore(path string, interval time.Duration) (*InMemoryStore, error) {
+	if dir := filepath.Dir(path); !exists(dir) {
+		return nil, fmt.Errorf("directory %s does not exist", dir)
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("couldn't lock %s: %w", lock.Name(), err)
+	}
+
+	s := NewInMemoryStore()
+	snap := &snapshots{path: path, lock: lock, stop: make(chan struct{}), done: make(chan struct{})}
+
+	v, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		log.Infof("There is no snapshot at %s yet, starting with an empty store", path)
+	case err != nil:
+		snap.unlock()
+		return nil, err
+	default:
+		if err := s.load(v); err != nil {
+			snap.unlock()
+			return nil, fmt.Errorf("snapshot %s: %w", path, err)
+		}
+		snap.saved = sha256.Sum256(v)
+		log.Infof("Loaded %d trekkingen from snapshot %s", len(s.trekkingen)+len(s.trash), path)
+	}
+
+	s.snapshots = snap
+	go s.snapshotPeriodically(interval)
+	return s, nil
+}
+
+// load fills an empty store with a snapshot. Unlike Import it keeps everything as it was, like the
+// versions and the time trekkingen were trashed.
+func (i *InMemoryStore) load(v []byte) error {
+	var e export
+	if err := json.Unmarshal(v, &e); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	if e.Version > ExportVersion {
+		return fmt.Errorf("%w: it has version %d, this version supports up to %d", ErrInvalidExport, e.Version, ExportVersion)
+	}
+
+	for _, t := range e.Trekkingen {
+		i.trekkingen[t.Name] = t
+	}
+	for _, t := range e.Trash {
+		i.trash[t.Name] = t
+	}
+	return nil
+}
+
+// snapshot returns all trekkingen of the store in the format of Export, as they are at one moment.
+func (i *InMemoryStore) snapshot() ([]byte, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	e := export{
+		Version:    ExportVersion,
+		Trekkingen: make([]lootjestrekken.Trekking, 0, len(i.trekkingen)),
+		Trash:      make([]lootjestrekken.Trekking, 0, len(i.trash)),
+	}
+	for _, k := range sortedKeys(i.trekkingen) {
+		e.Trekkingen = append(e.Trekkingen, i.trekkingen[k])
+	}
+	for _, k := range sortedKeys(i.trash) {
+		e.Trash = append(e.Trash, i.trash[k])
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(e)
+	return buf.Bytes(), err
+}
+
+// Backup writes a snapshot of the store, which OpenSnapshotStore and Import can read.
+func (i *InMemoryStore) Backup(w io.Writer) (int64, error) {
+	v, err := i.snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(v)
+	return int64(n), err
+}
+
+// Snapshot writes the store to its snapshot file, if anything changed since the last snapshot. The
+// file is replaced at once, so a crash never leaves half a snapshot behind.
+func (i *InMemoryStore) Snapshot() error {
+	if i.snapshots == nil {
+		return fmt.Errorf("store has no snapshot file")
+	}
+
+	snap := i.snapshots
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+
+	v, err := i.snapshot()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(v)
+	if sum == snap.saved {
+		return nil
+	}
+
+	if err := writeFileAtomic(snap.path, v); err != nil {
+		return err
+	}
+	snap.saved = sum
+	log.Debugf("Wrote snapshot %s", snap.path)
+	return nil
+}
+
+func (i *InMemoryStore) snapshotPeriodically(interval time.Duration) {
+	defer close(i.snapshots.done)
+
+	if interval <= 0 {
+		<-i.snapshots.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := i.Snapshot(); err != nil {
+				log.Errorf("Couldn't write snapshot: %v", err)
+			}
+		case <-i.snapshots.stop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic snapshots, writes a last one and unlocks the snapshot. It does nothing for
+// a store without snapshot file.
+func (i *InMemoryStore) Close() error {
+	if i.snapshots == nil {
+		return nil
+	}
+
+	i.snapshots.once.Do(func() {
+		close(i.snapshots.stop)
+	})
+	<-i.snapshots.done
+	err := i.Snapshot()
+	i.snapshots.unlock()
+	return err
+}
+
+// unlock lets other processes open the snapshot.
+func (snap *snapshots) unlock() {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+
+	if snap.lock != nil {
+		unlockFile(snap.lock)
+		snap.lock.Close()
+		snap.lock = nil
+	}
+}
+
+// writeFileAtomic writes a file next to path and then renames it to path, so that path always holds
+// either the old or the new contents. The file is only readable by its owner.
+func writeFileAtomic(path string, v []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(v)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
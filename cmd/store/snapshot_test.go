@@ -0,0 +1,129 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"lootjestrekken/pkg/lootjestrekken"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.json"
+	s, err := OpenSnapshotStore(path, 0)
+	assert.NoError(t, err)
+
+	trekking := lootjestrekken.Trekking{}
+	_, err = trekking.AddParticipant(lootjestrekken.Participant{Name: "jan", Email: "jan@example.com"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.AddTrekking("a", trekking))
+	assert.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error { return nil }))
+	assert.NoError(t, s.AddTrekking("b", lootjestrekken.Trekking{}))
+	assert.NoError(t, s.DeleteTrekking("b", nil))
+	trashed, err := s.GetTrashedTrekking("b")
+	assert.NoError(t, err)
+
+	// nothing is written until the store is closed
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, s.Close())
+
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	// next to the snapshot there is only its lock
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	s, err = OpenSnapshotStore(path, 0)
+	assert.NoError(t, err)
+	defer s.Close()
+	res, err := s.GetTrekking("a")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), res.Version)
+	assert.Equal(t, trekking.People, res.People)
+	res, err = s.GetTrashedTrekking("b")
+	assert.NoError(t, err)
+	assert.True(t, trashed.DeletedAt.Time.Equal(res.DeletedAt.Time))
+
+	// a snapshot is an export
+	v, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	count, err := Import(NewInMemoryStore(), bytes.NewReader(v))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestSnapshotUnchanged(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.json"
+	s, err := OpenSnapshotStore(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	// a store that didn't change doesn't write the snapshot again, which would replace the file
+	before, err := os.Stat(path)
+	assert.NoError(t, err)
+	s, err = OpenSnapshotStore(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Snapshot())
+	assert.NoError(t, s.Close())
+	after, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(before, after))
+
+	s, err = OpenSnapshotStore(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	assert.NoError(t, s.Close())
+	after, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.False(t, os.SameFile(before, after))
+}
+
+func TestSnapshotPeriodically(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.json"
+	s, err := OpenSnapshotStore(path, 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	assert.Eventually(t, func() bool {
+		v, err := ioutil.ReadFile(path)
+		return err == nil && bytes.Contains(v, []byte(`"Name": "a"`))
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSnapshotLocked(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.json"
+	s, err := OpenSnapshotStore(path, 0)
+	assert.NoError(t, err)
+
+	_, err = OpenSnapshotStore(path, 0)
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	assert.NoError(t, s.Close())
+	s, err = OpenSnapshotStore(path, 0)
+	if assert.NoError(t, err) {
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestInvalidSnapshot(t *testing.T) {
+	path := t.TempDir() + "/lootjestrekken.json"
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0600))
+	_, err := OpenSnapshotStore(path, 0)
+	assert.True(t, errors.Is(err, ErrInvalidExport))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"Version": 1000}`), 0600))
+	_, err = OpenSnapshotStore(path, 0)
+	assert.True(t, errors.Is(err, ErrInvalidExport))
+
+	assert.Error(t, NewInMemoryStore().Snapshot())
+	assert.NoError(t, NewInMemoryStore().Close())
+}
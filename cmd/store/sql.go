@@ -0,0 +1,671 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/glebarez/sqlite"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"lootjestrekken/pkg/lootjestrekken"
+	"net/url"
+	"time"
+)
+
+// trekkingRow is a trekking in the trekkingen table. Its people and draw are in their own tables,
+// the rules and other lists that are only ever read as a whole are kept as json.
+type trekkingRow struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// a trekking in the trash may have the name of a trekking that isn't
+	Name      string `gorm:"not null;uniqueIndex:idx_trekkingen_name"`
+	Trashed   bool   `gorm:"not null;uniqueIndex:idx_trekkingen_name"`
+	TrashedAt *time.Time
+
+	Version      uint64
+	State        int
+	Mode         int
+	Getrokken    bool
+	HistoryYears int
+	Commitment   string
+	Seed         []byte
+	Revealed     bool
+	Settings     string
+
+	Participants []participantRow `gorm:"foreignKey:TrekkingID"`
+	Assignments  []assignmentRow  `gorm:"foreignKey:TrekkingID"`
+}
+
+func (trekkingRow) TableName() string {
+	return "trekkingen"
+}
+
+// settings holds the parts of a trekking that are stored as json.
+type settings struct {
+	Exclusions []lootjestrekken.Exclusion
+	Households []lootjestrekken.Household
+	Previous   []string
+	History    []lootjestrekken.PastDraw
+	Inputs     *lootjestrekken.AuditInputs `json:",omitempty"`
+	Tokens     map[string]string
+	Organizers []lootjestrekken.Organizer
+	Redraws    []lootjestrekken.Redraw
+}
+
+type participantRow struct {
+	ID         uint `gorm:"primaryKey"`
+	TrekkingID uint `gorm:"not null;index"`
+	// Position keeps the people in their order, which the draw depends on.
+	Position      int
+	ParticipantID string `gorm:"not null"`
+	Name          string
+	Email         string
+	Attributes    string
+}
+
+func (participantRow) TableName() string {
+	return "participants"
+}
+
+// assignmentRow records that the giver drew the receiver.
+type assignmentRow struct {
+	ID         uint   `gorm:"primaryKey"`
+	TrekkingID uint   `gorm:"not null;index"`
+	GiverID    string `gorm:"not null"`
+	ReceiverID string `gorm:"not null"`
+}
+
+func (assignmentRow) TableName() string {
+	return "assignments"
+}
+
+func toRow(trekking lootjestrekken.Trekking) (trekkingRow, error) {
+	row := trekkingRow{
+		ID:           trekking.ID,
+		CreatedAt:    trekking.CreatedAt.UTC(),
+		UpdatedAt:    trekking.UpdatedAt.UTC(),
+		Name:         trekking.Name,
+		Trashed:      trekking.DeletedAt.Valid,
+		Version:      trekking.Version,
+		State:        int(trekking.State),
+		Mode:         int(trekking.Mode),
+		Getrokken:    trekking.Getrokken,
+		HistoryYears: trekking.HistoryYears,
+		Commitment:   trekking.Commitment,
+		Seed:         trekking.Seed,
+		Revealed:     trekking.Revealed,
+	}
+
+	// sqlite keeps times as text, which only compares like the times when they are all in UTC
+	if row.Trashed {
+		at := trekking.DeletedAt.Time.UTC()
+		row.TrashedAt = &at
+	}
+
+	encoded, err := json.Marshal(settings{
+		Exclusions: trekking.Exclusions,
+		Households: trekking.Households,
+		Previous:   trekking.Previous,
+		History:    trekking.History,
+		Inputs:     trekking.Inputs,
+		Tokens:     trekking.Tokens,
+		Organizers: trekking.Organizers,
+		Redraws:    trekking.Redraws,
+	})
+	if err != nil {
+		return trekkingRow{}, err
+	}
+	row.Settings = string(encoded)
+
+	for index, i := range trekking.People {
+		attributes := ""
+		if len(i.Attributes) > 0 {
+			encoded, err := json.Marshal(i.Attributes)
+			if err != nil {
+				return trekkingRow{}, err
+			}
+			attributes = string(encoded)
+		}
+
+		row.Participants = append(row.Participants, participantRow{
+			Position:      index,
+			ParticipantID: i.ID,
+			Name:          i.Name,
+			Email:         i.Email,
+			Attributes:    attributes,
+		})
+
+		if index < len(trekking.PeopleMapping) {
+			row.Assignments = append(row.Assignments, assignmentRow{GiverID: i.ID, ReceiverID: trekking.PeopleMapping[index]})
+		}
+	}
+
+	return row, nil
+}
+
+func fromRow(row trekkingRow) (lootjestrekken.Trekking, error) {
+	trekking := lootjestrekken.Trekking{
+		Version:      row.Version,
+		Name:         row.Name,
+		State:        lootjestrekken.State(row.State),
+		Mode:         lootjestrekken.DrawMode(row.Mode),
+		Getrokken:    row.Getrokken,
+		HistoryYears: row.HistoryYears,
+		Commitment:   row.Commitment,
+		Seed:         row.Seed,
+		Revealed:     row.Revealed,
+	}
+	trekking.ID = row.ID
+	trekking.CreatedAt = row.CreatedAt
+	trekking.UpdatedAt = row.UpdatedAt
+	if row.Trashed && row.TrashedAt != nil {
+		trekking.Trash(*row.TrashedAt)
+	}
+
+	var s settings
+	if err := json.Unmarshal([]byte(row.Settings), &s); err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+	trekking.Exclusions = s.Exclusions
+	trekking.Households = s.Households
+	trekking.Previous = s.Previous
+	trekking.History = s.History
+	trekking.Inputs = s.Inputs
+	trekking.Tokens = s.Tokens
+	trekking.Organizers = s.Organizers
+	trekking.Redraws = s.Redraws
+
+	receivers := make(map[string]string, len(row.Assignments))
+	for _, i := range row.Assignments {
+		receivers[i.GiverID] = i.ReceiverID
+	}
+
+	for _, i := range row.Participants {
+		p := lootjestrekken.Participant{ID: i.ParticipantID, Name: i.Name, Email: i.Email}
+		if i.Attributes != "" {
+			if err := json.Unmarshal([]byte(i.Attributes), &p.Attributes); err != nil {
+				return lootjestrekken.Trekking{}, err
+			}
+		}
+		trekking.People = append(trekking.People, p)
+
+		if receiver, ok := receivers[i.ParticipantID]; ok {
+			trekking.PeopleMapping = append(trekking.PeopleMapping, receiver)
+		}
+	}
+
+	return trekking, nil
+}
+
+// SQLStore keeps trekkingen in a SQL database through gorm.
+type SQLStore struct {
+	Db *gorm.DB
+	watchers
+}
+
+// load reads a trekking with its people and draw.
+func load(tx *gorm.DB, name string, trashed bool) (trekkingRow, error) {
+	var row trekkingRow
+	err := tx.
+		Preload("Participants", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Assignments").
+		Where("name = ? AND trashed = ?", name, trashed).
+		First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return trekkingRow{}, ErrNotFound
+	}
+	return row, err
+}
+
+func named(tx *gorm.DB, name string, trashed bool) (bool, error) {
+	var count int64
+	err := tx.Model(&trekkingRow{}).Where("name = ? AND trashed = ?", name, trashed).Count(&count).Error
+	return count > 0, err
+}
+
+// save stores a trekking over the row with the given id, as long as that row is still at the
+// given version.
+func save(tx *gorm.DB, id uint, version uint64, trekking lootjestrekken.Trekking) error {
+	row, err := toRow(trekking)
+	if err != nil {
+		return err
+	}
+	row.ID = id
+
+	res := tx.Model(&trekkingRow{ID: id}).Where("version = ?", version).Select("*").Omit("id", "created_at", clause.Associations).Updates(&row)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrConflict
+	}
+
+	return replaceChildren(tx, row)
+}
+
+// replaceChildren stores the people and draw of a trekking, replacing the earlier ones.
+func replaceChildren(tx *gorm.DB, row trekkingRow) error {
+	if err := tx.Where("trekking_id = ?", row.ID).Delete(&participantRow{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("trekking_id = ?", row.ID).Delete(&assignmentRow{}).Error; err != nil {
+		return err
+	}
+
+	for index := range row.Participants {
+		row.Participants[index].TrekkingID = row.ID
+	}
+	for index := range row.Assignments {
+		row.Assignments[index].TrekkingID = row.ID
+	}
+
+	if len(row.Participants) > 0 {
+		if err := tx.Create(&row.Participants).Error; err != nil {
+			return err
+		}
+	}
+	if len(row.Assignments) > 0 {
+		if err := tx.Create(&row.Assignments).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create stores a new trekking.
+func create(tx *gorm.DB, trekking lootjestrekken.Trekking) error {
+	row, err := toRow(trekking)
+	if err != nil {
+		return err
+	}
+	row.ID = 0
+
+	participants, assignments := row.Participants, row.Assignments
+	if err := tx.Omit(clause.Associations).Create(&row).Error; err != nil {
+		return err
+	}
+
+	row.Participants, row.Assignments = participants, assignments
+	return replaceChildren(tx, row)
+}
+
+// remove deletes a trekking with its people and draw.
+func remove(tx *gorm.DB, id uint) error {
+	if err := tx.Where("trekking_id = ?", id).Delete(&participantRow{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("trekking_id = ?", id).Delete(&assignmentRow{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&trekkingRow{}, id).Error
+}
+
+func (i *SQLStore) AddTrekking(name string, trekking lootjestrekken.Trekking) error {
+	log.Debugf("Adding trekking with name %s to store", name)
+
+	trekking.Name = name
+	trekking.CreatedAt = time.Now()
+	trekking.UpdatedAt = trekking.CreatedAt
+
+	return i.transaction(func(tx *gorm.DB) ([]Event, error) {
+		found, err := named(tx, name, false)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, ErrExists
+		}
+
+		return changes(nil, &trekking), create(tx, trekking)
+	})
+}
+
+func (i *SQLStore) names(trashed bool) ([]string, error) {
+	names := make([]string, 0)
+	err := i.Db.Model(&trekkingRow{}).Where("trashed = ?", trashed).Order("name").Pluck("name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (i *SQLStore) GetTrekkingNames() ([]string, error) {
+	log.Debug("getting all trekking names from store")
+
+	return i.names(false)
+}
+
+func (i *SQLStore) GetTrekkingInfos() ([]string, error) {
+	log.Debug("getting all trekking infos from store")
+
+	// the info only needs the columns of the trekking itself
+	var rows []trekkingRow
+	err := i.Db.Select("name", "getrokken").Where("trashed = ?", false).Order("name").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]string, 0, len(rows))
+	for _, row := range rows {
+		t := lootjestrekken.Trekking{Name: row.Name, Getrokken: row.Getrokken}
+		infos = append(infos, t.GetInfo())
+	}
+	return infos, nil
+}
+
+func (i *SQLStore) get(name string, trashed bool) (lootjestrekken.Trekking, error) {
+	row, err := load(i.Db, name, trashed)
+	if err != nil {
+		return lootjestrekken.Trekking{}, err
+	}
+
+	return fromRow(row)
+}
+
+func (i *SQLStore) GetTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trekking with name %s from store", name)
+
+	return i.get(name, false)
+}
+
+func (i *SQLStore) UpdateTrekking(trekking lootjestrekken.Trekking) error {
+	log.Debugf("updating trekking with name %s in store", trekking.Name)
+
+	return i.transaction(func(tx *gorm.DB) ([]Event, error) {
+		row, err := load(tx, trekking.Name, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if row.Version != trekking.Version {
+			return nil, ErrConflict
+		}
+
+		old, err := fromRow(row)
+		if err != nil {
+			return nil, err
+		}
+
+		trekking.DeletedAt = gorm.DeletedAt{}
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return changes(&old, &trekking), save(tx, row.ID, row.Version, trekking)
+	})
+}
+
+func (i *SQLStore) Modify(name string, change func(trekking *lootjestrekken.Trekking) error) error {
+	log.Debugf("modifying trekking with name %s in store", name)
+
+	// the version check in save makes a concurrent change fail instead of getting lost, in that case
+	// the change is made again on the new version
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		conflict := false
+		err := i.transaction(func(tx *gorm.DB) ([]Event, error) {
+			row, err := load(tx, name, false)
+			if err != nil {
+				return nil, err
+			}
+
+			old, err := fromRow(row)
+			if err != nil {
+				return nil, err
+			}
+
+			// fromRow makes new slices and maps every time
+			t, err := fromRow(row)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := change(&t); err != nil {
+				return nil, err
+			}
+
+			t.Name = name
+			t.DeletedAt = gorm.DeletedAt{}
+			t.Version = row.Version + 1
+			t.UpdatedAt = time.Now()
+			err = save(tx, row.ID, row.Version, t)
+			conflict = err == ErrConflict
+			return changes(&old, &t), err
+		})
+		if !conflict {
+			return err
+		}
+	}
+
+	return ErrConflict
+}
+
+func (i *SQLStore) DeleteTrekking(name string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Deleting trekking with name %s from store", name)
+
+	return i.transaction(func(tx *gorm.DB) ([]Event, error) {
+		row, err := load(tx, name, false)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := fromRow(row)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checked(check, t); err != nil {
+			return nil, err
+		}
+
+		found, err := named(tx, name, true)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, ErrExists
+		}
+
+		t.Trash(time.Now())
+		return changes(&t, nil), save(tx, row.ID, row.Version, t)
+	})
+}
+
+// move stores the trekking under name as newname, changed by change, in a single transaction, after
+// check accepts it. The original is kept as a separate trekking if keep is set.
+func (i *SQLStore) move(name string, trashed bool, newname string, check func(trekking lootjestrekken.Trekking) error, change func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking, keep bool) error {
+	return i.transaction(func(tx *gorm.DB) ([]Event, error) {
+		row, err := load(tx, name, trashed)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := fromRow(row)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checked(check, t); err != nil {
+			return nil, err
+		}
+
+		found, err := named(tx, newname, false)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, ErrExists
+		}
+
+		old := t
+		t = change(t)
+		t.Name = newname
+
+		events := changes(nil, &t)
+		if keep {
+			return events, create(tx, t)
+		}
+		if !trashed {
+			events = append(changes(&old, nil), events...)
+		}
+		return events, save(tx, row.ID, row.Version, t)
+	})
+}
+
+func (i *SQLStore) RenameTrekking(name, newname string, check func(trekking lootjestrekken.Trekking) error) error {
+	log.Debugf("Renaming trekking with name %s to %s in store", name, newname)
+
+	return i.move(name, false, newname, check, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *SQLStore) CloneTrekking(name, newname string) error {
+	log.Debugf("Cloning trekking with name %s to %s in store", name, newname)
+
+	return i.move(name, false, newname, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		clone := trekking.Clone()
+		clone.CreatedAt = time.Now()
+		clone.UpdatedAt = clone.CreatedAt
+		return clone
+	}, true)
+}
+
+func (i *SQLStore) GetTrashNames() ([]string, error) {
+	log.Debug("getting all trashed trekking names from store")
+
+	return i.names(true)
+}
+
+func (i *SQLStore) GetTrashedTrekking(name string) (lootjestrekken.Trekking, error) {
+	log.Debugf("getting trashed trekking with name %s from store", name)
+
+	return i.get(name, true)
+}
+
+func (i *SQLStore) RestoreTrekking(name string) error {
+	log.Debugf("Restoring trekking with name %s in store", name)
+
+	return i.move(name, true, name, nil, func(trekking lootjestrekken.Trekking) lootjestrekken.Trekking {
+		trekking.Restore()
+		trekking.Version++
+		trekking.UpdatedAt = time.Now()
+		return trekking
+	}, false)
+}
+
+func (i *SQLStore) PurgeTrash(before time.Time) error {
+	log.Debugf("Purging trekkingen trashed before %s from store", before)
+
+	return i.Db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Model(&trekkingRow{}).Where("trashed = ? AND trashed_at < ?", true, before.UTC()).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := remove(tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the connections to the database.
+func (i *SQLStore) Close() error {
+	db, err := i.Db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// transaction runs fn in a transaction, and publishes the events it returns once that is committed.
+func (i *SQLStore) transaction(fn func(tx *gorm.DB) ([]Event, error)) error {
+	var events []Event
+	err := i.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		events, err = fn(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	i.publish(events...)
+	return nil
+}
+
+// NewSQLStore uses the database of the dialector, creating or updating the tables it needs.
+func NewSQLStore(dialector gorm.Dialector) (*SQLStore, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.AutoMigrate(&trekkingRow{}, &participantRow{}, &assignmentRow{}); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		Db: db,
+	}, nil
+}
+
+// NewSQLiteStore uses a SQLite database in the given directory.
+func NewSQLiteStore(location string) (*SQLStore, error) {
+	if !exists(location) {
+		return nil, fmt.Errorf("directory %s does not exist", location)
+	}
+
+	return OpenSQLiteStore(location+"/lootjestrekken.sqlite", 5*time.Second)
+}
+
+// OpenSQLiteStore uses the SQLite database in the given file, creating it if needed. A change waits
+// up to timeout for another process that is changing the database.
+func OpenSQLiteStore(path string, timeout time.Duration) (*SQLStore, error) {
+	s, err := NewSQLStore(sqlite.Open(fmt.Sprintf("%s?_pragma=busy_timeout(%d)", path, timeout.Milliseconds())))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, waiting for the connection is cheaper than waiting for the lock
+	sqldb, err := s.Db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqldb.SetMaxOpenConns(1)
+
+	return s, nil
+}
+
+func init() {
+	// sqlite:///data/lootjes.sqlite?timeout=5s
+	Register("sqlite", func(u *url.URL) (Store, error) {
+		path, err := filePath(u)
+		if err != nil {
+			return nil, err
+		}
+
+		query, err := options(u, "timeout")
+		if err != nil {
+			return nil, err
+		}
+
+		timeout := 5 * time.Second
+		if value := query.Get("timeout"); value != "" {
+			if timeout, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("invalid timeout: %w", err)
+			}
+		}
+
+		return OpenSQLiteStore(path, timeout)
+	})
+}
@@ -1,17 +1,77 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"lootjestrekken/pkg/lootjestrekken"
+	"time"
 )
 
 var ErrExists = errors.New("name already exists")
+var ErrNotFound = errors.New("trekking name not found")
+var ErrConflict = errors.New("trekking was changed concurrently")
 
+// maxRetries is how often a store makes a change again when another change to the same trekking got
+// in between, before it gives up with ErrConflict. It is high enough for dozens of changes to the same
+// trekking at once.
+const maxRetries = 100
+
+// Store keeps trekkingen by name. A Store is safe for concurrent use. Methods return ErrNotFound for a
+// name that isn't stored and ErrExists for a name that is already in use. Trekkingen that are passed
+// in or returned share nothing with the stored ones. The package storetest checks all of this.
 type Store interface {
+	// AddTrekking stores a new trekking under the given name.
 	AddTrekking(name string, trekking lootjestrekken.Trekking) error
+	// GetTrekkingNames returns the names of all trekkingen, sorted.
 	GetTrekkingNames() ([]string, error)
+	// GetTrekkingInfos returns lootjestrekken.Trekking.GetInfo of all trekkingen, sorted by name.
 	GetTrekkingInfos() ([]string, error)
 	GetTrekking(name string) (lootjestrekken.Trekking, error)
+	// UpdateTrekking stores a changed trekking, as long as the stored trekking is still at the same
+	// Version. It then increments the stored Version, and otherwise returns ErrConflict.
 	UpdateTrekking(trekking lootjestrekken.Trekking) error
+	// Modify reads, changes and stores a trekking in one step, so that nobody can change it in
+	// between. When change returns an error nothing is stored and Modify returns that error.
+	// Otherwise the Version is incremented. The name of the trekking can't be changed this way.
+	Modify(name string, change func(trekking *lootjestrekken.Trekking) error) error
+	// DeleteTrekking moves a trekking to the trash. When check isn't nil it gets the stored trekking
+	// first, in the same transaction, and when it returns an error nothing changes and DeleteTrekking
+	// returns that error. check must not change the trekking. When the trash already has a trekking
+	// with the same name DeleteTrekking returns ErrExists, so that one isn't lost.
+	DeleteTrekking(name string, check func(trekking lootjestrekken.Trekking) error) error
+	// RenameTrekking moves a trekking to a new name that is not in use yet, after check accepts it like
+	// with DeleteTrekking.
+	RenameTrekking(name, newname string, check func(trekking lootjestrekken.Trekking) error) error
+	// CloneTrekking stores lootjestrekken.Trekking.Clone of a trekking under a new name that is not in use yet.
+	CloneTrekking(name, newname string) error
+
+	// GetTrashNames returns the names of all trekkingen in the trash, sorted.
+	GetTrashNames() ([]string, error)
+	GetTrashedTrekking(name string) (lootjestrekken.Trekking, error)
+	// RestoreTrekking moves a trekking out of the trash, if no other trekking took its name.
+	RestoreTrekking(name string) error
+	// PurgeTrash permanently removes the trekkingen that were moved to the trash before the given time.
+	PurgeTrash(before time.Time) error
+
+	// Watch sends the changes to the trekking with the given name, as Events, until ctx is done. It
+	// only sees the changes that are made through this Store.
+	Watch(ctx context.Context, name string) <-chan Event
+	// WatchAll is like Watch for the changes to all trekkingen.
+	WatchAll(ctx context.Context) <-chan Event
 }
 
+// checked runs the check of DeleteTrekking or RenameTrekking, if there is one.
+func checked(check func(trekking lootjestrekken.Trekking) error, trekking lootjestrekken.Trekking) error {
+	if check == nil {
+		return nil
+	}
+	return check(trekking)
+}
+
+// Appender is implemented by stores that can add people to a trekking without reading the people it
+// already has. Append is like Store.Modify, but change gets the trekking without its People,
+// PeopleMapping and Tokens. The People and Tokens it adds are appended to the stored ones, and
+// changes to anything else are stored as with Modify.
+type Appender interface {
+	Append(name string, change func(trekking *lootjestrekken.Trekking) error) error
+}
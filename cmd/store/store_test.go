@@ -0,0 +1,77 @@
+package store_test
+
+import (
+	"bytes"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"lootjestrekken/cmd/store"
+	"lootjestrekken/cmd/store/storetest"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return store.NewInMemoryStore()
+	})
+}
+
+func TestSnapshotStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.OpenSnapshotStore(t.TempDir()+"/lootjestrekken.json", 10*time.Millisecond)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, s.Close()) })
+		return s
+	})
+}
+
+func TestDbStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.NewDbStore(t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Db.Close() })
+		return s
+	})
+}
+
+func TestEncryptedDbStore(t *testing.T) {
+	keys, err := store.NewKeys(bytes.Repeat([]byte{1}, store.KeySize))
+	require.NoError(t, err)
+
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.OpenDbStore(t.TempDir()+"/lootjestrekken.db", nil, keys)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Db.Close() })
+		return s
+	})
+}
+
+func TestSQLStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.NewSQLiteStore(t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestRedisStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s := store.NewRedisStore(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}), store.DefaultRedisPrefix)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestDirStore(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) store.Store {
+				s, err := store.NewDirStore(t.TempDir(), format)
+				require.NoError(t, err)
+				return s
+			})
+		})
+	}
+}
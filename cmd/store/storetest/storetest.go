@@ -0,0 +1,498 @@
+// Package storetest checks that an implementation of store.Store keeps the contract that the
+// handlers rely on. Call Run from a test of the implementation:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store {
+//			return NewMyStore()
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lootjestrekken/cmd/store"
+	"lootjestrekken/pkg/lootjestrekken"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory returns a new, empty store. Anything it needs to clean up can be registered with t.Cleanup.
+type Factory func(t *testing.T) store.Store
+
+// Run checks the contract of store.Store against stores made by newStore. Every check gets a store of
+// its own.
+func Run(t *testing.T, newStore Factory) {
+	checks := []struct {
+		name  string
+		check func(t *testing.T, s store.Store)
+	}{
+		{"Add", testAdd},
+		{"Get", testGet},
+		{"Ordering", testOrdering},
+		{"Update", testUpdate},
+		{"Modify", testModify},
+		{"Delete", testDelete},
+		{"Rename", testRename},
+		{"Clone", testClone},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"ConcurrentModify", testConcurrentModify},
+		{"ConcurrentUpdate", testConcurrentUpdate},
+		{"Watch", testWatch},
+	}
+
+	for _, i := range checks {
+		i := i
+		t.Run(i.name, func(t *testing.T) {
+			i.check(t, newStore(t))
+		})
+	}
+}
+
+// drawn returns an auditable getrokken trekking with people that have an email, attributes and rules.
+func drawn(t *testing.T) lootjestrekken.Trekking {
+	trekking := lootjestrekken.Trekking{}
+	for _, i := range []string{"jan", "piet", "klaas", "marie"} {
+		_, err := trekking.AddPerson(i)
+		require.NoError(t, err)
+	}
+	require.NoError(t, trekking.SetEmail("jan", "jan@example.com"))
+	require.NoError(t, trekking.SetAttribute("piet", "size", "L"))
+	trekking.AddExclusion("jan", "piet")
+	require.NoError(t, trekking.Commit())
+	require.NoError(t, trekking.TrekCommitted())
+	return trekking
+}
+
+func testAdd(t *testing.T, s store.Store) {
+	trekking := drawn(t)
+	trekking.Name = "other"
+	require.NoError(t, s.AddTrekking("a", trekking))
+	assert.Equal(t, store.ErrExists, s.AddTrekking("a", lootjestrekken.Trekking{}))
+
+	stored, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", stored.Name)
+	assert.Equal(t, trekking.People, stored.People)
+	assert.Equal(t, trekking.PeopleMapping, stored.PeopleMapping)
+	assert.Equal(t, trekking.Exclusions, stored.Exclusions)
+	assert.Equal(t, trekking.Seed, stored.Seed)
+	assert.Equal(t, trekking.Inputs, stored.Inputs)
+	assert.True(t, stored.Getrokken)
+	assert.False(t, stored.CreatedAt.IsZero())
+
+	// the name given is the one that counts
+	_, err = s.GetTrekking("other")
+	assert.Equal(t, store.ErrNotFound, err)
+}
+
+func testGet(t *testing.T, s store.Store) {
+	_, err := s.GetTrekking("a")
+	assert.Equal(t, store.ErrNotFound, err)
+
+	trekking := drawn(t)
+	require.NoError(t, s.AddTrekking("a", trekking))
+
+	// changing what was passed in or returned doesn't change what is stored
+	trekking.People[0].Name = "changed"
+	stored, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.NotEqual(t, "changed", stored.People[0].Name)
+
+	stored.People[0].Name = "changed"
+	stored.PeopleMapping[0] = "changed"
+	again, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.NotEqual(t, "changed", again.People[0].Name)
+	assert.NotEqual(t, "changed", again.PeopleMapping[0])
+}
+
+func testOrdering(t *testing.T, s store.Store) {
+	names, err := s.GetTrekkingNames()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	for _, i := range []string{"b", "c", "a", "B"} {
+		require.NoError(t, s.AddTrekking(i, lootjestrekken.Trekking{}))
+	}
+
+	names, err = s.GetTrekkingNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B", "a", "b", "c"}, names)
+
+	infos, err := s.GetTrekkingInfos()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B", "a", "b", "c"}, infos)
+
+	for _, i := range []string{"c", "a", "b"} {
+		require.NoError(t, s.DeleteTrekking(i, nil))
+	}
+	names, err = s.GetTrashNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+}
+
+func testUpdate(t *testing.T, s store.Store) {
+	assert.Equal(t, store.ErrNotFound, s.UpdateTrekking(lootjestrekken.Trekking{Name: "a"}))
+
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	trekking, err := s.GetTrekking("a")
+	require.NoError(t, err)
+
+	_, err = trekking.AddPerson("jan")
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateTrekking(trekking))
+
+	// the version that was read is no longer the stored one
+	assert.Equal(t, store.ErrConflict, s.UpdateTrekking(trekking))
+
+	stored, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.Equal(t, trekking.Version+1, stored.Version)
+	assert.Equal(t, []string{"jan"}, stored.Names())
+	require.NoError(t, s.UpdateTrekking(stored))
+}
+
+func testModify(t *testing.T, s store.Store) {
+	nothing := func(trekking *lootjestrekken.Trekking) error { return nil }
+	assert.Equal(t, store.ErrNotFound, s.Modify("a", nothing))
+
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	err := s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		trekking.Name = "b"
+		_, err := trekking.AddPerson("jan")
+		return err
+	})
+	require.NoError(t, err)
+
+	// a failing change stores nothing, not even the part made before it failed
+	err = s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		_, _ = trekking.AddPerson("piet")
+		return lootjestrekken.ErrDuplicatePerson
+	})
+	assert.Equal(t, lootjestrekken.ErrDuplicatePerson, err)
+
+	// only a conflict in the store itself makes it try again, not one returned by the change
+	calls := 0
+	err = s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		calls++
+		return store.ErrConflict
+	})
+	assert.Equal(t, store.ErrConflict, err)
+	assert.Equal(t, 1, calls)
+
+	stored, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", stored.Name)
+	assert.Equal(t, []string{"jan"}, stored.Names())
+	assert.Equal(t, uint64(1), stored.Version)
+
+	_, err = s.GetTrekking("b")
+	assert.Equal(t, store.ErrNotFound, err)
+}
+
+func testDelete(t *testing.T, s store.Store) {
+	assert.Equal(t, store.ErrNotFound, s.DeleteTrekking("a", nil))
+
+	require.NoError(t, s.AddTrekking("a", drawn(t)))
+	require.NoError(t, s.DeleteTrekking("a", nil))
+	assert.Equal(t, store.ErrNotFound, s.DeleteTrekking("a", nil))
+
+	_, err := s.GetTrekking("a")
+	assert.Equal(t, store.ErrNotFound, err)
+	names, err := s.GetTrekkingNames()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	trashed, err := s.GetTrashedTrekking("a")
+	require.NoError(t, err)
+	assert.True(t, trashed.Getrokken)
+	assert.True(t, trashed.TrashedBefore(time.Now().Add(time.Second)))
+
+	// the name can be used again, but deleting that trekking would lose the one in the trash
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	assert.Equal(t, store.ErrExists, s.DeleteTrekking("a", nil))
+	trashed, err = s.GetTrashedTrekking("a")
+	require.NoError(t, err)
+	assert.True(t, trashed.Getrokken)
+	_, err = s.GetTrekking("a")
+	assert.NoError(t, err)
+
+	// the check gets the stored trekking, and when it fails nothing is deleted
+	failed := errors.New("not allowed")
+	require.NoError(t, s.AddTrekking("c", drawn(t)))
+	err = s.DeleteTrekking("c", func(trekking lootjestrekken.Trekking) error {
+		assert.Equal(t, "c", trekking.Name)
+		assert.True(t, trekking.Getrokken)
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	_, err = s.GetTrekking("c")
+	assert.NoError(t, err)
+	require.NoError(t, s.DeleteTrekking("c", func(trekking lootjestrekken.Trekking) error { return nil }))
+
+	_, err = s.GetTrashedTrekking("b")
+	assert.Equal(t, store.ErrNotFound, err)
+}
+
+func testRename(t *testing.T, s store.Store) {
+	assert.Equal(t, store.ErrNotFound, s.RenameTrekking("a", "b", nil))
+
+	trekking := drawn(t)
+	require.NoError(t, s.AddTrekking("a", trekking))
+	require.NoError(t, s.AddTrekking("c", lootjestrekken.Trekking{}))
+	assert.Equal(t, store.ErrExists, s.RenameTrekking("a", "c", nil))
+
+	failed := errors.New("not allowed")
+	assert.Equal(t, failed, s.RenameTrekking("a", "b", func(trekking lootjestrekken.Trekking) error { return failed }))
+	_, err := s.GetTrekking("b")
+	assert.Equal(t, store.ErrNotFound, err)
+
+	require.NoError(t, s.RenameTrekking("a", "b", func(trekking lootjestrekken.Trekking) error {
+		assert.Equal(t, "a", trekking.Name)
+		return nil
+	}))
+	_, err = s.GetTrekking("a")
+	assert.Equal(t, store.ErrNotFound, err)
+
+	stored, err := s.GetTrekking("b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", stored.Name)
+	assert.Equal(t, trekking.PeopleMapping, stored.PeopleMapping)
+	assert.Equal(t, uint64(1), stored.Version)
+}
+
+func testClone(t *testing.T, s store.Store) {
+	assert.Equal(t, store.ErrNotFound, s.CloneTrekking("a", "b"))
+
+	trekking := drawn(t)
+	require.NoError(t, s.AddTrekking("a", trekking))
+	require.NoError(t, s.AddTrekking("c", lootjestrekken.Trekking{}))
+	assert.Equal(t, store.ErrExists, s.CloneTrekking("a", "c"))
+
+	require.NoError(t, s.CloneTrekking("a", "b"))
+	clone, err := s.GetTrekking("b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", clone.Name)
+	assert.Equal(t, trekking.IDs(), clone.IDs())
+	assert.False(t, clone.Getrokken)
+
+	original, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.True(t, original.Getrokken)
+}
+
+func testRestore(t *testing.T, s store.Store) {
+	assert.Equal(t, store.ErrNotFound, s.RestoreTrekking("a"))
+
+	require.NoError(t, s.AddTrekking("a", drawn(t)))
+	require.NoError(t, s.DeleteTrekking("a", nil))
+
+	// a trekking that took the name blocks the restore
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	assert.Equal(t, store.ErrExists, s.RestoreTrekking("a"))
+	require.NoError(t, s.RenameTrekking("a", "b", nil))
+
+	require.NoError(t, s.RestoreTrekking("a"))
+	assert.Equal(t, store.ErrNotFound, s.RestoreTrekking("a"))
+
+	restored, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.True(t, restored.Getrokken)
+	assert.False(t, restored.TrashedBefore(time.Now().Add(time.Second)))
+	require.NoError(t, s.UpdateTrekking(restored))
+
+	names, err := s.GetTrashNames()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func testPurge(t *testing.T, s store.Store) {
+	require.NoError(t, s.PurgeTrash(time.Now()))
+
+	for _, i := range []string{"a", "b"} {
+		require.NoError(t, s.AddTrekking(i, drawn(t)))
+		require.NoError(t, s.DeleteTrekking(i, nil))
+	}
+
+	// the time zone of before doesn't matter, it is a date later than the trash in UTC+14
+	require.NoError(t, s.PurgeTrash(time.Now().Add(-time.Hour).In(time.FixedZone("UTC+14", 14*60*60))))
+	names, err := s.GetTrashNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	require.NoError(t, s.PurgeTrash(time.Now().Add(time.Second).In(time.FixedZone("UTC-12", -12*60*60))))
+	names, err = s.GetTrashNames()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	_, err = s.GetTrashedTrekking("a")
+	assert.Equal(t, store.ErrNotFound, err)
+	assert.Equal(t, store.ErrNotFound, s.RestoreTrekking("a"))
+}
+
+// testConcurrentModify makes many changes at the same time, none of them may get lost.
+func testConcurrentModify(t *testing.T, s store.Store) {
+	num := 50
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+
+	var wg sync.WaitGroup
+	wg.Add(num)
+	errs := make(chan error, num)
+	for i := 0; i < num; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			errs <- s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+				_, err := trekking.AddPerson(fmt.Sprintf("person%d", i))
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	stored, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.Len(t, stored.People, num)
+	assert.Equal(t, uint64(num), stored.Version)
+}
+
+// testConcurrentUpdate stores many changes of the same version at the same time, only one of them
+// may be stored.
+func testConcurrentUpdate(t *testing.T, s store.Store) {
+	num := 20
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	trekking, err := s.GetTrekking("a")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(num)
+	errs := make(chan error, num)
+	for i := 0; i < num; i++ {
+		i := i
+		changed := trekking
+		go func() {
+			defer wg.Done()
+			changed.Seed = []byte{byte(i)}
+			errs <- s.UpdateTrekking(changed)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	stored := 0
+	for err := range errs {
+		if err == nil {
+			stored++
+		} else {
+			assert.Equal(t, store.ErrConflict, err)
+		}
+	}
+	assert.Equal(t, 1, stored)
+
+	res, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	assert.Equal(t, trekking.Version+1, res.Version)
+}
+
+// next returns the next event on events, failing when there is none.
+func next(t *testing.T, events <-chan store.Event) store.Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "watch ended")
+		return e
+	case <-time.After(time.Second):
+		require.FailNow(t, "no event")
+		return store.Event{}
+	}
+}
+
+// testWatch makes changes of every kind and checks the events that watchers get.
+func testWatch(t *testing.T, s store.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := s.Watch(ctx, "a")
+	all := s.WatchAll(ctx)
+
+	expect := func(events <-chan store.Event, kind store.EventType, name string) store.Event {
+		t.Helper()
+		e := next(t, events)
+		assert.Equal(t, kind, e.Type)
+		assert.Equal(t, name, e.Name)
+		return e
+	}
+
+	require.NoError(t, s.AddTrekking("a", lootjestrekken.Trekking{}))
+	expect(a, store.Added, "a")
+	expect(all, store.Added, "a")
+	require.NoError(t, s.AddTrekking("b", lootjestrekken.Trekking{}))
+	expect(all, store.Added, "b")
+
+	require.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		for _, i := range []string{"jan", "piet", "klaas", "marie"} {
+			if _, err := trekking.AddPerson(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	for _, i := range []string{"jan", "piet", "klaas", "marie"} {
+		assert.Equal(t, i, expect(a, store.PersonAdded, "a").Person.Name)
+		expect(all, store.PersonAdded, "a")
+	}
+
+	require.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		return trekking.RemovePerson("marie")
+	}))
+	e := expect(a, store.PersonRemoved, "a")
+	assert.Equal(t, "marie", e.Person.Name)
+	assert.Equal(t, uint64(2), e.Version)
+	expect(all, store.PersonRemoved, "a")
+
+	require.NoError(t, s.Modify("a", func(trekking *lootjestrekken.Trekking) error {
+		return trekking.Trek()
+	}))
+	expect(a, store.Drawn, "a")
+	expect(all, store.Drawn, "a")
+
+	trekking, err := s.GetTrekking("a")
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateTrekking(trekking))
+	expect(a, store.Changed, "a")
+	expect(all, store.Changed, "a")
+
+	// a change that fails sends nothing
+	assert.Error(t, s.UpdateTrekking(trekking))
+
+	require.NoError(t, s.RenameTrekking("a", "c", nil))
+	expect(a, store.Deleted, "a")
+	expect(all, store.Deleted, "a")
+	expect(all, store.Added, "c")
+
+	require.NoError(t, s.DeleteTrekking("b", nil))
+	expect(all, store.Deleted, "b")
+	require.NoError(t, s.RestoreTrekking("b"))
+	expect(all, store.Added, "b")
+
+	// the watch of a doesn't see c, and ends with ctx
+	cancel()
+	for _, events := range []<-chan store.Event{a, all} {
+		select {
+		case e, ok := <-events:
+			assert.False(t, ok, "unexpected event %v", e)
+		case <-time.After(time.Second):
+			assert.Fail(t, "watch didn't end")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"lootjestrekken/pkg/lootjestrekken"
+	"reflect"
+	"sync"
+)
+
+// EventType tells what kind of change an Event is.
+type EventType string
+
+const (
+	// Added is a trekking that was added, cloned, restored from the trash or renamed to its name.
+	Added EventType = "added"
+	// Deleted is a trekking that was moved to the trash or renamed to another name.
+	Deleted EventType = "deleted"
+	// PersonAdded is a person that was added to a trekking.
+	PersonAdded EventType = "person-added"
+	// PersonRemoved is a person that was removed from a trekking.
+	PersonRemoved EventType = "person-removed"
+	// Drawn is a trekking that was drawn, or drawn again.
+	Drawn EventType = "drawn"
+	// Changed is any other change to a trekking.
+	Changed EventType = "changed"
+)
+
+// Event is a change to a trekking, as sent by Store.Watch.
+type Event struct {
+	Type EventType
+	// Name is the name of the trekking.
+	Name string
+	// Version is the version of the trekking after the change, or before it for Deleted.
+	Version uint64
+	// Person is the person that was added or removed, for PersonAdded and PersonRemoved. It only
+	// has their ID and Name, the rest of what is known about them isn't sent to watchers.
+	Person lootjestrekken.Participant
+}
+
+// watchBuffer is how many events a watcher can fall behind before it is dropped.
+const watchBuffer = 100
+
+// watchers sends the events of a store to everyone watching it. Stores embed it for Watch and
+// WatchAll, and publish their changes after storing them. Its zero value has no watchers.
+type watchers struct {
+	mu      sync.Mutex
+	watches map[*watch]bool
+}
+
+type watch struct {
+	name   string
+	all    bool
+	events chan Event
+	// done is closed when the watch is removed, also when that happens before ctx is done.
+	done chan struct{}
+}
+
+// Watch sends the changes to the trekking with the given name until ctx is done, and then closes
+// the channel. A watcher that falls behind too far has its channel closed early, it then has to
+// read the trekking again to know where it stands.
+func (w *watchers) Watch(ctx context.Context, name string) <-chan Event {
+	return w.add(ctx, &watch{name: name, events: make(chan Event, watchBuffer)})
+}
+
+// WatchAll is like Watch for the changes to all trekkingen.
+func (w *watchers) WatchAll(ctx context.Context) <-chan Event {
+	return w.add(ctx, &watch{all: true, events: make(chan Event, watchBuffer)})
+}
+
+func (w *watchers) add(ctx context.Context, x *watch) <-chan Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watches == nil {
+		w.watches = map[*watch]bool{}
+	}
+	w.watches[x] = true
+	x.done = make(chan struct{})
+
+	// a context that is never done, like context.Background, keeps the watch until it falls behind
+	if ctx.Done() == nil {
+		return x.events
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.remove(x)
+		case <-x.done:
+		}
+	}()
+
+	return x.events
+}
+
+// remove closes the channel of a watch, if that didn't happen yet. It needs the lock.
+func (w *watchers) remove(x *watch) {
+	if w.watches[x] {
+		delete(w.watches, x)
+		close(x.events)
+		close(x.done)
+	}
+}
+
+// publish sends events to the watchers they are for. It doesn't wait for watchers.
+func (w *watchers) publish(events ...Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, e := range events {
+		for x := range w.watches {
+			if !x.all && x.name != e.Name {
+				continue
+			}
+
+			select {
+			case x.events <- e:
+			default:
+				log.Warnf("Dropping a watcher that fell %d events behind", watchBuffer)
+				w.remove(x)
+			}
+		}
+	}
+}
+
+// changes returns the events for the change of a trekking from old to new. Old is nil for a trekking
+// that is new and new is nil for one that is gone.
+func changes(old, new *lootjestrekken.Trekking) []Event {
+	switch {
+	case old == nil:
+		return []Event{{Type: Added, Name: new.Name, Version: new.Version}}
+	case new == nil:
+		return []Event{{Type: Deleted, Name: old.Name, Version: old.Version}}
+	}
+
+	oldIDs := map[string]bool{}
+	for _, i := range old.People {
+		oldIDs[i.ID] = true
+	}
+	newIDs := map[string]bool{}
+	for _, i := range new.People {
+		newIDs[i.ID] = true
+	}
+
+	var events []Event
+	for _, i := range old.People {
+		if !newIDs[i.ID] {
+			events = append(events, Event{Type: PersonRemoved, Name: new.Name, Version: new.Version, Person: public(i)})
+		}
+	}
+	for _, i := range new.People {
+		if !oldIDs[i.ID] {
+			events = append(events, Event{Type: PersonAdded, Name: new.Name, Version: new.Version, Person: public(i)})
+		}
+	}
+	if new.Getrokken && !reflect.DeepEqual(old.PeopleMapping, new.PeopleMapping) {
+		events = append(events, Event{Type: Drawn, Name: new.Name, Version: new.Version})
+	}
+
+	if len(events) == 0 {
+		events = append(events, Event{Type: Changed, Name: new.Name, Version: new.Version})
+	}
+	return events
+}
+
+// public returns what watchers may know about a person.
+func public(person lootjestrekken.Participant) lootjestrekken.Participant {
+	return lootjestrekken.Participant{ID: person.ID, Name: person.Name}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"lootjestrekken/pkg/lootjestrekken"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	old := lootjestrekken.Trekking{Name: "a", People: []lootjestrekken.Participant{{ID: "1", Name: "jan"}, {ID: "2", Name: "piet"}}}
+	new := lootjestrekken.Trekking{Name: "a", Version: 1, People: []lootjestrekken.Participant{
+		{ID: "2", Name: "piet"},
+		{ID: "3", Name: "klaas", Email: "klaas@example.com", Attributes: map[string]string{"adres": "Dorpsstraat 1"}},
+	}}
+
+	// watchers don't get the email and attributes of a person
+	assert.Equal(t, []Event{
+		{Type: PersonRemoved, Name: "a", Version: 1, Person: old.People[0]},
+		{Type: PersonAdded, Name: "a", Version: 1, Person: lootjestrekken.Participant{ID: "3", Name: "klaas"}},
+	}, changes(&old, &new))
+
+	new.People = old.People
+	assert.Equal(t, []Event{{Type: Changed, Name: "a", Version: 1}}, changes(&old, &new))
+
+	new.Getrokken = true
+	new.PeopleMapping = []string{"2", "1"}
+	assert.Equal(t, []Event{{Type: Drawn, Name: "a", Version: 1}}, changes(&old, &new))
+
+	assert.Equal(t, []Event{{Type: Added, Name: "a", Version: 1}}, changes(nil, &new))
+	assert.Equal(t, []Event{{Type: Deleted, Name: "a"}}, changes(&old, nil))
+}
+
+func TestSlowWatcher(t *testing.T) {
+	w := &watchers{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slow := w.Watch(ctx, "a")
+	other := w.Watch(ctx, "b")
+
+	for i := 0; i <= watchBuffer; i++ {
+		w.publish(Event{Type: Changed, Name: "a", Version: uint64(i)})
+	}
+	w.publish(Event{Type: Changed, Name: "b"})
+
+	// the events that fit are still there, then the channel ends
+	count := 0
+	for range slow {
+		count++
+	}
+	assert.Equal(t, watchBuffer, count)
+	assert.Equal(t, Event{Type: Changed, Name: "b"}, <-other)
+}
+
+func TestWatchGoroutines(t *testing.T) {
+	w := &watchers{}
+	before := runtime.NumGoroutine()
+
+	// a watch that can't end needs nothing to wait for the end
+	for i := 0; i < 10; i++ {
+		w.WatchAll(context.Background())
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+
+	// a watch that is dropped before ctx is done doesn't wait for ctx any longer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.Watch(ctx, "a")
+	for i := 0; i <= watchBuffer; i++ {
+		w.publish(Event{Type: Changed, Name: "a"})
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
@@ -0,0 +1,184 @@
+package lootjestrekken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// seedLength is the number of random bytes in the seed of an auditable draw.
+const seedLength = 32
+
+var (
+	ErrNotCommitted       = errors.New("trekking has no commitment")
+	ErrCommitmentMismatch = errors.New("seed and inputs of the draw don't match the commitment")
+	ErrDrawMismatch       = errors.New("draw doesn't match the replay from the seed")
+)
+
+// AuditInputs are everything an auditable draw depends on besides its seed: the sorted ids of the
+// people, the draw mode, the pairs the rules forbid and how often every pair was drawn before. Rules
+// and history are kept as the pairs they amount to, so that the same draw always has the same inputs.
+type AuditInputs struct {
+	People   []string
+	Mode     string
+	Excluded []Pair
+	Repeats  []Pair
+}
+
+// Pair is a giver and a receiver, Count times.
+type Pair struct {
+	Giver    string
+	Receiver string
+	Count    int `json:",omitempty"`
+}
+
+// AuditInputs returns what the next draw of t depends on, with the given linked draws.
+func (t *Trekking) AuditInputs(linked ...PastDraw) AuditInputs {
+	people := sortedParticipants(t.People)
+	draws := t.recentDraws(linked)
+
+	excluded := t.excludedPairs(people)
+	repeats := repeatedPairs(draws, people)
+
+	inputs := AuditInputs{People: make([]string, 0, len(people)), Mode: t.Mode.String(), Excluded: []Pair{}, Repeats: []Pair{}}
+	for g, giver := range people {
+		inputs.People = append(inputs.People, giver.ID)
+		for r, receiver := range people {
+			if giver.ID == receiver.ID {
+				continue
+			}
+
+			if excluded[g][r] {
+				inputs.Excluded = append(inputs.Excluded, Pair{Giver: giver.ID, Receiver: receiver.ID})
+			}
+			if count := repeats[g][r]; count > 0 {
+				inputs.Repeats = append(inputs.Repeats, Pair{Giver: giver.ID, Receiver: receiver.ID, Count: count})
+			}
+		}
+	}
+	return inputs
+}
+
+// Encode returns the json of the inputs that a commitment hashes.
+func (in AuditInputs) Encode() []byte {
+	// lists of strings and numbers always encode
+	encoded, _ := json.Marshal(in)
+	return encoded
+}
+
+// Replay draws the trekking the inputs describe from seed, the way TrekCommitted drew it.
+func (in AuditInputs) Replay(seed []byte) (Trekking, error) {
+	mode, err := ParseDrawMode(in.Mode)
+	if err != nil {
+		return Trekking{}, err
+	}
+
+	t := Trekking{Mode: mode}
+	for _, i := range in.People {
+		t.People = append(t.People, Participant{ID: i, Name: i})
+	}
+	for _, i := range in.Excluded {
+		t.Exclusions = append(t.Exclusions, Exclusion{A: i.Giver, B: i.Receiver})
+	}
+	for _, i := range in.Repeats {
+		for n := 0; n < i.Count; n++ {
+			t.History = append(t.History, PastDraw{People: []string{i.Giver}, PeopleMapping: []string{i.Receiver}})
+		}
+	}
+
+	return t, t.TrekWith(seededRandomness(seed))
+}
+
+// Commitment returns the hex encoded sha256 hash of the seed followed by the encoded inputs.
+func Commitment(seed []byte, inputs AuditInputs) string {
+	hash := sha256.New()
+	hash.Write(seed)
+	hash.Write(inputs.Encode())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// seededRandomness derives the deterministic randomness of an auditable draw from its seed.
+func seededRandomness(seed []byte) Randomness {
+	sum := sha256.Sum256(seed)
+	return NewSeededRandomness(int64(binary.BigEndian.Uint64(sum[:8])))
+}
+
+func (t *Trekking) Committed() bool {
+	return t.Commitment != ""
+}
+
+// Commit makes the next draw auditable. It picks a secret seed and publishes a commitment to it and
+// the inputs of the draw, with the given linked draws, so that none of them can change any more.
+// Committing again keeps the existing commitment.
+func (t *Trekking) Commit(linked ...PastDraw) error {
+	if t.Committed() {
+		return nil
+	}
+
+	seed := make([]byte, seedLength)
+	if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+
+	inputs := t.AuditInputs(linked...)
+	t.Seed = seed
+	t.Inputs = &inputs
+	t.Commitment = Commitment(seed, inputs)
+	return nil
+}
+
+// TrekCommitted draws a committed trekking deterministically from its seed, starting from the
+// sorted participants, so that anyone can replay it with Verify once the seed is revealed. It
+// returns ErrCommitmentMismatch when the inputs of the draw changed since the commitment.
+func (t *Trekking) TrekCommitted(linked ...PastDraw) error {
+	if !t.Committed() {
+		return ErrNotCommitted
+	}
+
+	if Commitment(t.Seed, t.AuditInputs(linked...)) != t.Commitment {
+		return ErrCommitmentMismatch
+	}
+
+	t.People = sortedParticipants(t.People)
+	return t.TrekWith(seededRandomness(t.Seed), linked...)
+}
+
+// Verify checks a draw offline. The seed and the inputs of the draw of t, with the same linked
+// draws, have to match the commitment, and replaying the draw from them has to give every
+// participant the person t says they drew.
+func Verify(commitment string, seed []byte, t Trekking, linked ...PastDraw) error {
+	return VerifyInputs(commitment, seed, t.AuditInputs(linked...), t)
+}
+
+// VerifyInputs checks a draw like Verify, with the inputs that were published with the seed.
+func VerifyInputs(commitment string, seed []byte, inputs AuditInputs, t Trekking) error {
+	if Commitment(seed, inputs) != commitment {
+		return ErrCommitmentMismatch
+	}
+
+	if len(t.PeopleMapping) != len(t.People) {
+		return ErrDrawMismatch
+	}
+
+	replay, err := inputs.Replay(seed)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range t.People {
+		expected, err := replay.GetrokkenPerson(i.ID)
+		if err != nil {
+			return ErrDrawMismatch
+		}
+
+		actual, err := t.GetrokkenPerson(i.ID)
+		if err != nil || actual.ID != expected.ID {
+			return ErrDrawMismatch
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCommitVerify(t *testing.T) {
+	trekking := Trekking{People: participants("d", "b", "a", "c", "e")}
+	trekking.AddExclusion("a", "b")
+	assert.Equal(t, ErrNotCommitted, trekking.TrekCommitted())
+
+	assert.NoError(t, trekking.Commit())
+	commitment := trekking.Commitment
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, trekking.Inputs.People)
+	assert.Equal(t, []Pair{{Giver: "a", Receiver: "b"}, {Giver: "b", Receiver: "a"}}, trekking.Inputs.Excluded)
+	assert.Equal(t, Commitment(trekking.Seed, *trekking.Inputs), commitment)
+
+	// committing again keeps the published commitment
+	assert.NoError(t, trekking.Commit())
+	assert.Equal(t, commitment, trekking.Commitment)
+
+	assert.NoError(t, trekking.TrekCommitted())
+	assert.NoError(t, Verify(commitment, trekking.Seed, trekking))
+
+	wrongSeed := append([]byte(nil), trekking.Seed...)
+	wrongSeed[0]++
+	assert.Equal(t, ErrCommitmentMismatch, Verify(commitment, wrongSeed, trekking))
+
+	tampered := trekking
+	tampered.PeopleMapping = append([]string(nil), trekking.PeopleMapping...)
+	tampered.PeopleMapping[0], tampered.PeopleMapping[1] = tampered.PeopleMapping[1], tampered.PeopleMapping[0]
+	assert.Equal(t, ErrDrawMismatch, Verify(commitment, trekking.Seed, tampered))
+}
+
+func TestCommitVerifyHistory(t *testing.T) {
+	last := PastDraw{People: []string{"a", "b", "c", "d"}, PeopleMapping: []string{"b", "c", "d", "a"}}
+
+	trekking := Trekking{People: participants("a", "b", "c", "d")}
+	assert.NoError(t, trekking.Commit(last))
+	assert.NoError(t, trekking.TrekCommitted(last))
+
+	assert.NoError(t, Verify(trekking.Commitment, trekking.Seed, trekking, last))
+}
+
+func TestCommitCoversRules(t *testing.T) {
+	trekking := Trekking{People: participants("a", "b", "c", "d", "e")}
+	assert.NoError(t, trekking.Commit())
+
+	// changing the rules after the commitment would let the organizer pick the draw
+	changed := trekking
+	changed.AddExclusion("a", "b")
+	assert.Equal(t, ErrCommitmentMismatch, changed.TrekCommitted())
+
+	changed = trekking
+	changed.Mode = Derangement
+	assert.Equal(t, ErrCommitmentMismatch, changed.TrekCommitted())
+
+	last := PastDraw{People: []string{"a"}, PeopleMapping: []string{"b"}}
+	assert.Equal(t, ErrCommitmentMismatch, trekking.TrekCommitted(last))
+
+	assert.NoError(t, trekking.TrekCommitted())
+	changed = trekking
+	changed.AddExclusion("a", "c")
+	assert.Equal(t, ErrCommitmentMismatch, Verify(trekking.Commitment, trekking.Seed, changed))
+}
+
+func TestVerifyInputs(t *testing.T) {
+	last := PastDraw{People: []string{"a", "b", "c", "d", "e"}, PeopleMapping: []string{"b", "c", "d", "e", "a"}}
+
+	trekking := Trekking{People: participants("e", "d", "c", "b", "a"), Mode: NoTwoCycles}
+	trekking.AddToHousehold("ab", "a")
+	trekking.AddToHousehold("ab", "b")
+	assert.NoError(t, trekking.Commit(last))
+	assert.NoError(t, trekking.TrekCommitted(last))
+
+	// the published inputs are enough to replay the draw, without the rules themselves
+	inputs := *trekking.Inputs
+	assert.NoError(t, VerifyInputs(trekking.Commitment, trekking.Seed, inputs, trekking))
+
+	inputs.Repeats = nil
+	assert.Equal(t, ErrCommitmentMismatch, VerifyInputs(trekking.Commitment, trekking.Seed, inputs, trekking))
+}
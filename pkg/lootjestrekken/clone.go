@@ -0,0 +1,26 @@
+package lootjestrekken
+
+// Clone returns a new draft trekking with the people, rules, settings and organizers of this one,
+// but without its draw. Personal links are not copied, since they point at this trekking.
+func (t *Trekking) Clone() Trekking {
+	clone := Trekking{
+		Name:         t.Name,
+		Exclusions:   append([]Exclusion(nil), t.Exclusions...),
+		Previous:     append([]string(nil), t.Previous...),
+		History:      append([]PastDraw(nil), t.History...),
+		HistoryYears: t.HistoryYears,
+		Mode:         t.Mode,
+		Organizers:   append([]Organizer(nil), t.Organizers...),
+	}
+
+	// people keep their id, so that the draws of this trekking can be avoided in the clone
+	for _, p := range t.People {
+		clone.People = append(clone.People, p.copy())
+	}
+
+	for _, h := range t.Households {
+		clone.Households = append(clone.Households, Household{Name: h.Name, Members: append([]string(nil), h.Members...)})
+	}
+
+	return clone
+}
@@ -0,0 +1,35 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	trekking := Trekking{Name: "2020", People: participants("a", "b", "c"), Mode: Derangement}
+	trekking.AddToHousehold("ab", "a")
+	_, err := trekking.AddOrganizer("owner")
+	assert.NoError(t, err)
+	_, err = trekking.IssueToken("a")
+	assert.NoError(t, err)
+	assert.NoError(t, trekking.Transition(Closed))
+	assert.NoError(t, trekking.Commit())
+	assert.NoError(t, trekking.TrekCommitted())
+	assert.NoError(t, trekking.Transition(Drawn))
+
+	clone := trekking.Clone()
+	assert.ElementsMatch(t, trekking.People, clone.People)
+	assert.Equal(t, trekking.Households, clone.Households)
+	assert.Equal(t, trekking.Organizers, clone.Organizers)
+	assert.Equal(t, Derangement, clone.Mode)
+
+	assert.Equal(t, Draft, clone.State)
+	assert.False(t, clone.Getrokken)
+	assert.Nil(t, clone.PeopleMapping)
+	assert.False(t, clone.Committed())
+	assert.Nil(t, clone.Tokens)
+
+	// the clone doesn't share its rules with the original
+	clone.AddToHousehold("ab", "c")
+	assert.Equal(t, []string{"a"}, trekking.Households[0].Members)
+}
@@ -0,0 +1,176 @@
+package lootjestrekken
+
+// Exclusion forbids two people from drawing each other, in either direction. A and B refer to people
+// by id, or by name for people that weren't part of the trekking when the exclusion was added.
+type Exclusion struct {
+	A string
+	B string
+}
+
+func (e Exclusion) matches(a, b string) bool {
+	return (e.A == a && e.B == b) || (e.A == b && e.B == a)
+}
+
+// Household is a named group of people that never draw someone from their own group. Like for an
+// Exclusion, Members refer to people by id or by name.
+type Household struct {
+	Name    string
+	Members []string
+}
+
+func (h *Household) contains(ref string) bool {
+	for _, i := range h.Members {
+		if i == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// includes reports whether the participant is a member of the household.
+func (h *Household) includes(p Participant) bool {
+	for _, i := range h.Members {
+		if p.is(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Trekking) AddExclusion(a, b string) {
+	a, b = t.Resolve(a), t.Resolve(b)
+	for _, e := range t.Exclusions {
+		if e.matches(a, b) {
+			return
+		}
+	}
+
+	t.Exclusions = append(t.Exclusions, Exclusion{A: a, B: b})
+}
+
+// RemoveExclusion removes the exclusion between a and b and reports whether there was one.
+func (t *Trekking) RemoveExclusion(a, b string) bool {
+	a, b = t.Resolve(a), t.Resolve(b)
+	for index, e := range t.Exclusions {
+		if e.matches(a, b) {
+			t.Exclusions = append(t.Exclusions[:index], t.Exclusions[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Trekking) household(name string) *Household {
+	for index := range t.Households {
+		if t.Households[index].Name == name {
+			return &t.Households[index]
+		}
+	}
+	return nil
+}
+
+// AddToHousehold adds a person to the named household, creating the household if needed.
+func (t *Trekking) AddToHousehold(household, name string) {
+	name = t.Resolve(name)
+	h := t.household(household)
+	if h == nil {
+		t.Households = append(t.Households, Household{Name: household})
+		h = &t.Households[len(t.Households)-1]
+	}
+
+	if !h.contains(name) {
+		h.Members = append(h.Members, name)
+	}
+}
+
+// RemoveFromHousehold removes a person from the named household and reports whether they were in it.
+// Households that become empty are removed.
+func (t *Trekking) RemoveFromHousehold(household, name string) bool {
+	name = t.Resolve(name)
+	for hindex := range t.Households {
+		h := &t.Households[hindex]
+		if h.Name != household {
+			continue
+		}
+
+		for index, i := range h.Members {
+			if i == name {
+				h.Members = append(h.Members[:index], h.Members[index+1:]...)
+				if len(h.Members) == 0 {
+					t.Households = append(t.Households[:hindex], t.Households[hindex+1:]...)
+				}
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Excluded reports whether the exclusion rules forbid giver from drawing receiver.
+func (t *Trekking) Excluded(giver, receiver Participant) bool {
+	for _, e := range t.Exclusions {
+		if (giver.is(e.A) && receiver.is(e.B)) || (giver.is(e.B) && receiver.is(e.A)) {
+			return true
+		}
+	}
+
+	for index := range t.Households {
+		h := &t.Households[index]
+		if h.includes(giver) && h.includes(receiver) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludedPairs returns for every giver and receiver among people whether the rules forbid the draw,
+// like Excluded. It looks every person up once, instead of going through all rules for every pair.
+func (t *Trekking) excludedPairs(people []Participant) [][]bool {
+	byRef := map[string][]int{}
+	for index, p := range people {
+		byRef[p.ID] = append(byRef[p.ID], index)
+		if p.Name != p.ID {
+			byRef[p.Name] = append(byRef[p.Name], index)
+		}
+	}
+
+	// referred returns the people that refs refer to, each of them once
+	referred := func(refs ...string) []int {
+		seen := map[int]bool{}
+		var res []int
+		for _, ref := range refs {
+			for _, index := range byRef[ref] {
+				if !seen[index] {
+					seen[index] = true
+					res = append(res, index)
+				}
+			}
+		}
+		return res
+	}
+
+	excluded := make([][]bool, len(people))
+	for index := range excluded {
+		excluded[index] = make([]bool, len(people))
+	}
+	exclude := func(a, b []int) {
+		for _, i := range a {
+			for _, j := range b {
+				excluded[i][j] = true
+				excluded[j][i] = true
+			}
+		}
+	}
+
+	for _, e := range t.Exclusions {
+		exclude(referred(e.A), referred(e.B))
+	}
+	for index := range t.Households {
+		members := referred(t.Households[index].Members...)
+		exclude(members, members)
+	}
+	return excluded
+}
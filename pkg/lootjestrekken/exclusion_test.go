@@ -0,0 +1,210 @@
+package lootjestrekken
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTrekExclusions(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		trekking := Trekking{}
+		for _, p := range []string{"a", "b", "c", "d", "e", "f"} {
+			trekking.AddPerson(p)
+		}
+		trekking.AddToHousehold("ab", "a")
+		trekking.AddToHousehold("ab", "b")
+		trekking.AddExclusion("c", "d")
+
+		assert.NoError(t, trekking.Trek())
+		assert.True(t, trekking.Getrokken)
+
+		for _, giver := range trekking.People {
+			receiver, err := trekking.GetrokkenPerson(giver.ID)
+			assert.NoError(t, err)
+			assert.NotEqual(t, giver.ID, receiver.ID)
+			assert.False(t, trekking.Excluded(giver, receiver), "%s drew %s", giver.Name, receiver.Name)
+		}
+	}
+}
+
+func TestTrekExclusionsUniform(t *testing.T) {
+	// with four people there are six single cycles, and forbidding a and b from drawing each other
+	// leaves exactly two of them: a -> c -> b -> d -> a and a -> d -> b -> c -> a
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		trekking := Trekking{People: participants("a", "b", "c", "d")}
+		trekking.AddExclusion("a", "b")
+		assert.NoError(t, trekking.Trek())
+
+		res, err := trekking.GetrokkenPerson("a")
+		assert.NoError(t, err)
+		counts[res.Name]++
+	}
+
+	assert.Equal(t, 2, len(counts))
+	assert.InDelta(t, 5000, counts["c"], 300)
+	assert.InDelta(t, 5000, counts["d"], 300)
+}
+
+func TestTrekImpossible(t *testing.T) {
+	trekking := Trekking{}
+	for i := 0; i < 5; i++ {
+		trekking.AddPerson(fmt.Sprint(i))
+	}
+
+	// a household holding more than half of the people leaves no single cycle
+	trekking.AddToHousehold("big", "0")
+	trekking.AddToHousehold("big", "1")
+	trekking.AddToHousehold("big", "2")
+
+	assert.Equal(t, ErrNoValidAssignment, trekking.Trek())
+	assert.False(t, trekking.Getrokken)
+}
+
+func TestEnumerateTight(t *testing.T) {
+	trekking := Trekking{People: participants("a", "b", "c", "d", "e", "f")}
+	trekking.AddToHousehold("abc", "a")
+	trekking.AddToHousehold("abc", "b")
+	trekking.AddToHousehold("abc", "c")
+
+	perm, err := enumerate(DefaultRandomness, len(trekking.People), func(giver, receiver int) bool {
+		return giver != receiver && !trekking.Excluded(trekking.People[giver], trekking.People[receiver])
+	}, noCost)
+	assert.NoError(t, err)
+
+	for giver, receiver := range perm {
+		assert.False(t, trekking.Excluded(trekking.People[giver], trekking.People[receiver]))
+	}
+}
+
+func TestRemoveRules(t *testing.T) {
+	trekking := Trekking{}
+	trekking.AddExclusion("a", "b")
+	trekking.AddExclusion("b", "a")
+	assert.Equal(t, 1, len(trekking.Exclusions))
+	assert.True(t, trekking.RemoveExclusion("b", "a"))
+	assert.False(t, trekking.RemoveExclusion("a", "b"))
+
+	trekking.AddToHousehold("h", "a")
+	a := Participant{ID: "a", Name: "a"}
+	assert.True(t, trekking.Excluded(a, a))
+	assert.True(t, trekking.RemoveFromHousehold("h", "a"))
+	assert.Equal(t, 0, len(trekking.Households))
+}
+
+func TestExcludedPairs(t *testing.T) {
+	trekking := Trekking{}
+	for _, i := range []string{"jan", "piet", "klaas", "marie", "anna"} {
+		trekking.AddPerson(i)
+	}
+	// a rule from before piet joined refers to him by name
+	trekking.Exclusions = append(trekking.Exclusions, Exclusion{A: "piet", B: trekking.Resolve("marie")})
+	trekking.AddExclusion("jan", "anna")
+	trekking.AddToHousehold("h", "klaas")
+	trekking.AddToHousehold("h", "marie")
+	trekking.AddToHousehold("h", "jan")
+
+	excluded := trekking.excludedPairs(trekking.People)
+	for g, giver := range trekking.People {
+		for r, receiver := range trekking.People {
+			assert.Equal(t, trekking.Excluded(giver, receiver), excluded[g][r], "%s draws %s", giver.Name, receiver.Name)
+		}
+	}
+}
+
+func TestTrekImpossibleLarge(t *testing.T) {
+	trekking := Trekking{}
+	for i := 0; i < 30; i++ {
+		trekking.AddPerson(fmt.Sprint(i))
+		if i <= 15 {
+			trekking.AddToHousehold("big", fmt.Sprint(i))
+		}
+	}
+
+	before := trekking.IDs()
+	start := time.Now()
+	assert.Equal(t, ErrNoValidAssignment, trekking.Trek())
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// a draw that fails leaves the people as they were
+	assert.Equal(t, before, trekking.IDs())
+	assert.False(t, trekking.Getrokken)
+	assert.Nil(t, trekking.PeopleMapping)
+
+	// someone who may draw nobody
+	trekking = Trekking{}
+	for i := 0; i < 30; i++ {
+		trekking.AddPerson(fmt.Sprint(i))
+		trekking.AddExclusion("0", fmt.Sprint(i))
+	}
+	assert.Equal(t, ErrNoValidAssignment, trekking.Trek())
+}
+
+func TestTrekTightLarge(t *testing.T) {
+	// half of the people in one household leaves only cycles that alternate, too few to find at random
+	trekking := Trekking{}
+	for i := 0; i < 20; i++ {
+		trekking.AddPerson(fmt.Sprint(i))
+		if i%2 == 0 {
+			trekking.AddToHousehold("half", fmt.Sprint(i))
+		}
+	}
+
+	start := time.Now()
+	assert.NoError(t, trekking.Trek())
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	for _, giver := range trekking.People {
+		receiver, err := trekking.GetrokkenPerson(giver.ID)
+		assert.NoError(t, err)
+		assert.False(t, trekking.Excluded(giver, receiver))
+	}
+}
+
+func TestTrekTightHuge(t *testing.T) {
+	// far too many people to search, the draw is built from a matching instead
+	for _, mode := range []DrawMode{SingleCycle, Derangement, NoTwoCycles} {
+		trekking := Trekking{Mode: mode}
+		for i := 0; i < 1000; i++ {
+			trekking.People = append(trekking.People, Participant{ID: fmt.Sprint(i), Name: fmt.Sprint(i)})
+			if i%2 == 0 {
+				trekking.AddToHousehold("half", fmt.Sprint(i))
+			}
+		}
+
+		start := time.Now()
+		assert.NoError(t, trekking.Trek(), mode.String())
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second), mode.String())
+
+		perm := make([]int, len(trekking.People))
+		for giver, p := range trekking.People {
+			receiver, err := trekking.GetrokkenPerson(p.ID)
+			assert.NoError(t, err)
+			assert.False(t, trekking.Excluded(p, receiver), mode.String())
+			perm[giver], _ = trekking.index(receiver.ID)
+		}
+		assert.True(t, mode.permits(perm), mode.String())
+	}
+}
+
+func TestConstruct(t *testing.T) {
+	// everyone draws someone of the other half, and a matching of that is usually many small cycles
+	allowed := func(giver, receiver int) bool {
+		return giver%2 != receiver%2
+	}
+	for _, mode := range []DrawMode{SingleCycle, Derangement, NoTwoCycles} {
+		perm, err := construct(mode, 40, allowed)
+		if assert.NoError(t, err, mode.String()) {
+			assert.True(t, mode.permits(perm), mode.String())
+			assert.True(t, valid(perm, allowed), mode.String())
+		}
+	}
+
+	// two people can only swap, which is not a cycle without 2-cycles
+	_, err := construct(NoTwoCycles, 2, allowed)
+	assert.Equal(t, ErrSearchExhausted, err)
+	_, err = construct(SingleCycle, 3, func(giver, receiver int) bool { return receiver != 2 })
+	assert.Equal(t, ErrNoValidAssignment, err)
+}
@@ -0,0 +1,139 @@
+package lootjestrekken
+
+import (
+	"sort"
+	"time"
+)
+
+// PastDraw is the result of an earlier draw, in which People[i] drew PeopleMapping[i]. Both refer to
+// people by id.
+type PastDraw struct {
+	People        []string
+	PeopleMapping []string
+	// At is when the draw was made. Draws without it count as older than the ones with it.
+	At time.Time
+}
+
+// PastDraw returns the result of this trekking as history for a later one, dated when the trekking
+// was created.
+func (t *Trekking) PastDraw() PastDraw {
+	return PastDraw{
+		People:        t.IDs(),
+		PeopleMapping: append([]string(nil), t.PeopleMapping...),
+		At:            t.CreatedAt,
+	}
+}
+
+// LinkedDraw returns the result of an earlier trekking as history for this one. People keep their
+// id when both trekkingen share it, for example because this one is a clone, and are otherwise
+// matched by name.
+func (t *Trekking) LinkedDraw(previous Trekking) PastDraw {
+	draw := previous.PastDraw()
+	for index := range draw.People {
+		draw.People[index] = t.link(previous, draw.People[index])
+	}
+	for index := range draw.PeopleMapping {
+		draw.PeopleMapping[index] = t.link(previous, draw.PeopleMapping[index])
+	}
+	return draw
+}
+
+func (t *Trekking) link(previous Trekking, id string) string {
+	if _, err := t.index(id); err == nil {
+		return id
+	}
+	return t.Resolve(previous.DisplayName(id))
+}
+
+// AddHistory adds an earlier draw, in which people may be referred to by id or by name.
+func (t *Trekking) AddHistory(draw PastDraw) {
+	resolved := PastDraw{At: draw.At}
+	for _, i := range draw.People {
+		resolved.People = append(resolved.People, t.Resolve(i))
+	}
+	for _, i := range draw.PeopleMapping {
+		resolved.PeopleMapping = append(resolved.PeopleMapping, t.Resolve(i))
+	}
+
+	t.History = append(t.History, resolved)
+}
+
+func (t *Trekking) LinkPrevious(name string) {
+	for _, i := range t.Previous {
+		if i == name {
+			return
+		}
+	}
+
+	t.Previous = append(t.Previous, name)
+}
+
+// UnlinkPrevious removes a linked earlier trekking and reports whether it was linked.
+func (t *Trekking) UnlinkPrevious(name string) bool {
+	for index, i := range t.Previous {
+		if i == name {
+			t.Previous = append(t.Previous[:index], t.Previous[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// recentDraws combines the explicit history with the draws of linked trekkingen, ordered by date,
+// and keeps the last HistoryYears of them. Draws without a date come first, the explicit history
+// before the linked draws, in the order they were added.
+func (t *Trekking) recentDraws(linked []PastDraw) []PastDraw {
+	draws := make([]PastDraw, 0, len(t.History)+len(linked))
+	draws = append(draws, t.History...)
+	draws = append(draws, linked...)
+	sort.SliceStable(draws, func(i, j int) bool {
+		return draws[i].At.Before(draws[j].At)
+	})
+
+	if t.HistoryYears > 0 && len(draws) > t.HistoryYears {
+		draws = draws[len(draws)-t.HistoryYears:]
+	}
+
+	return draws
+}
+
+// Repeats counts how often giver drew receiver in the given draws.
+func Repeats(draws []PastDraw, giver, receiver string) int {
+	count := 0
+	for _, d := range draws {
+		for index, i := range d.People {
+			if i == giver && index < len(d.PeopleMapping) && d.PeopleMapping[index] == receiver {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// repeatedPairs returns for every giver and receiver among people how often the giver drew the
+// receiver in the given draws, like Repeats for every pair at once.
+func repeatedPairs(draws []PastDraw, people []Participant) [][]int {
+	byID := make(map[string]int, len(people))
+	for index, p := range people {
+		byID[p.ID] = index
+	}
+
+	repeats := make([][]int, len(people))
+	for index := range repeats {
+		repeats[index] = make([]int, len(people))
+	}
+	for _, d := range draws {
+		for index, i := range d.People {
+			giver, ok := byID[i]
+			if !ok || index >= len(d.PeopleMapping) {
+				continue
+			}
+			if receiver, ok := byID[d.PeopleMapping[index]]; ok {
+				repeats[giver][receiver]++
+			}
+		}
+	}
+	return repeats
+}
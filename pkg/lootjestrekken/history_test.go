@@ -0,0 +1,164 @@
+package lootjestrekken
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTrekAvoidsHistory(t *testing.T) {
+	last := PastDraw{People: []string{"a", "b", "c", "d"}, PeopleMapping: []string{"b", "c", "d", "a"}}
+
+	// a -> d -> c -> b -> a is the only single cycle that repeats none of last year's pairs
+	for i := 0; i < 1000; i++ {
+		trekking := Trekking{People: participants("a", "b", "c", "d")}
+		assert.NoError(t, trekking.Trek(last))
+
+		res, err := trekking.GetrokkenPerson("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "d", res.ID)
+	}
+}
+
+func TestTrekFewestRepeats(t *testing.T) {
+	abc := PastDraw{People: []string{"a", "b", "c"}, PeopleMapping: []string{"b", "c", "a"}}
+	acb := PastDraw{People: []string{"a", "b", "c"}, PeopleMapping: []string{"c", "a", "b"}}
+
+	for i := 0; i < 100; i++ {
+		// both cycles repeat, but a -> c -> b -> a repeats less often
+		trekking := Trekking{People: participants("a", "b", "c"), History: []PastDraw{abc, abc, acb}}
+		assert.NoError(t, trekking.Trek())
+
+		res, err := trekking.GetrokkenPerson("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "c", res.ID)
+	}
+}
+
+func TestTrekHistoryYears(t *testing.T) {
+	abc := PastDraw{People: []string{"a", "b", "c"}, PeopleMapping: []string{"b", "c", "a"}}
+	acb := PastDraw{People: []string{"a", "b", "c"}, PeopleMapping: []string{"c", "a", "b"}}
+
+	for i := 0; i < 100; i++ {
+		// only the most recent year, the linked acb draw, is avoided
+		trekking := Trekking{People: participants("a", "b", "c"), History: []PastDraw{abc}, HistoryYears: 1}
+		assert.NoError(t, trekking.Trek(acb))
+
+		res, err := trekking.GetrokkenPerson("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "b", res.ID)
+	}
+}
+
+func TestRecentDrawsByDate(t *testing.T) {
+	year := func(y int) time.Time {
+		return time.Date(y, time.December, 5, 0, 0, 0, 0, time.UTC)
+	}
+	undated := PastDraw{People: []string{"a"}, PeopleMapping: []string{"b"}}
+	old := PastDraw{People: []string{"a"}, PeopleMapping: []string{"c"}, At: year(2021)}
+	recent := PastDraw{People: []string{"a"}, PeopleMapping: []string{"d"}, At: year(2023)}
+	linked := PastDraw{People: []string{"a"}, PeopleMapping: []string{"e"}, At: year(2022)}
+
+	// a linked trekking isn't necessarily more recent than the explicit history
+	trekking := Trekking{History: []PastDraw{recent, undated, old}}
+	assert.Equal(t, []PastDraw{undated, old, linked, recent}, trekking.recentDraws([]PastDraw{linked}))
+
+	trekking.HistoryYears = 2
+	assert.Equal(t, []PastDraw{linked, recent}, trekking.recentDraws([]PastDraw{linked}))
+}
+
+func TestTrekHistoryWithExclusions(t *testing.T) {
+	last := PastDraw{People: []string{"a"}, PeopleMapping: []string{"c"}}
+
+	// excluding a and b leaves a -> c -> b -> d -> a and a -> d -> b -> c -> a, of which only the
+	// second one avoids last year's pair
+	for i := 0; i < 100; i++ {
+		trekking := Trekking{People: participants("a", "b", "c", "d")}
+		trekking.AddExclusion("a", "b")
+		assert.NoError(t, trekking.Trek(last))
+
+		res, err := trekking.GetrokkenPerson("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "d", res.ID)
+	}
+}
+
+func TestTrekRepeatsLarge(t *testing.T) {
+	// everyone has drawn everyone else once, and everyone but the one seven places on a second time,
+	// so the fewest repeats are one for everyone, in the single cycle of drawing seven places on
+	people := make([]string, 20)
+	for i := range people {
+		people[i] = fmt.Sprint(i)
+	}
+	rotation := func(places int) []string {
+		mapping := make([]string, len(people))
+		for i := range mapping {
+			mapping[i] = people[(i+places)%len(people)]
+		}
+		return mapping
+	}
+
+	for _, mode := range []DrawMode{SingleCycle, Derangement, NoTwoCycles} {
+		trekking := Trekking{Mode: mode}
+		for _, i := range people {
+			trekking.AddPerson(i)
+		}
+		for places := 1; places < len(people); places++ {
+			trekking.AddHistory(PastDraw{People: people, PeopleMapping: rotation(places)})
+			if places != 7 {
+				trekking.AddHistory(PastDraw{People: people, PeopleMapping: rotation(places)})
+			}
+		}
+
+		start := time.Now()
+		require.NoError(t, trekking.Trek(), mode.String())
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second), mode.String())
+
+		repeats := 0
+		for _, giver := range trekking.People {
+			receiver, err := trekking.GetrokkenPerson(giver.ID)
+			require.NoError(t, err)
+			repeats += Repeats(trekking.History, giver.ID, receiver.ID)
+		}
+		assert.Equal(t, len(people), repeats, mode.String())
+	}
+}
+
+func TestLowestCost(t *testing.T) {
+	// the cheapest derangement of 6 people, found by trying all of them
+	n := 6
+	costs := [][]int{}
+	for giver := 0; giver < n; giver++ {
+		row := []int{}
+		for receiver := 0; receiver < n; receiver++ {
+			row = append(row, (giver*7+receiver*3)%5)
+		}
+		costs = append(costs, row)
+	}
+	allowed := func(giver, receiver int) bool { return giver != 1 || receiver != 2 }
+	cost := func(giver, receiver int) int { return costs[giver][receiver] }
+
+	lowest := -1
+	var try func(giver int, used []bool, total int)
+	try = func(giver int, used []bool, total int) {
+		if giver == n {
+			if lowest < 0 || total < lowest {
+				lowest = total
+			}
+			return
+		}
+		for receiver := 0; receiver < n; receiver++ {
+			if !used[receiver] && receiver != giver && allowed(giver, receiver) {
+				used[receiver] = true
+				try(giver+1, used, total+cost(giver, receiver))
+				used[receiver] = false
+			}
+		}
+	}
+	try(0, make([]bool, n), 0)
+
+	assert.Equal(t, lowest, lowestCost(n, allowed, cost))
+	assert.Equal(t, 0, lowestCost(n, allowed, noCost))
+}
@@ -0,0 +1,113 @@
+package lootjestrekken
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// State is where a trekking is in its lifecycle.
+type State int
+
+const (
+	// Draft trekkingen are being set up. Only organizers can add people.
+	Draft State = iota
+	// Open trekkingen let anyone sign up.
+	Open
+	// Closed trekkingen no longer let people sign up and are ready to be drawn.
+	Closed
+	// Drawn trekkingen have a result that everyone can look up with their personal link.
+	Drawn
+	// Revealed trekkingen have had their event, the draw is no longer a secret.
+	Revealed
+	// Archived trekkingen are kept for history only.
+	Archived
+)
+
+var (
+	ErrUnknownState      = errors.New("unknown state")
+	ErrInvalidTransition = errors.New("invalid state transition")
+)
+
+var stateNames = map[State]string{
+	Draft:    "draft",
+	Open:     "open",
+	Closed:   "closed",
+	Drawn:    "drawn",
+	Revealed: "revealed",
+	Archived: "archived",
+}
+
+// transitions lists the states every state can move to. Drawing again after a draw is not a
+// transition but a Redraw.
+var transitions = map[State][]State{
+	Draft:    {Open, Closed},
+	Open:     {Closed},
+	Closed:   {Open, Drawn},
+	Drawn:    {Revealed},
+	Revealed: {Archived},
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseState returns the state with the given name, as returned by State.String.
+func ParseState(name string) (State, error) {
+	for state, i := range stateNames {
+		if i == name {
+			return state, nil
+		}
+	}
+	return 0, ErrUnknownState
+}
+
+// CanTransition reports whether a trekking in this state may move to the other state.
+func (s State) CanTransition(to State) bool {
+	for _, i := range transitions[s] {
+		if i == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the trekking to another state, if its current state allows that.
+func (t *Trekking) Transition(to State) error {
+	if !t.State.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+
+	t.State = to
+	return nil
+}
+
+// Redraw records that a drawn trekking was drawn again, who did it and why.
+type Redraw struct {
+	At     time.Time
+	By     string
+	Reason string
+}
+
+// RecordRedraw adds an entry to the audit log of redraws.
+func (t *Trekking) RecordRedraw(by, reason string) {
+	t.Redraws = append(t.Redraws, Redraw{At: time.Now().UTC(), By: by, Reason: reason})
+}
+
+// UnmarshalJSON decodes a trekking. Trekkingen stored before the lifecycle existed only know
+// whether they are getrokken, so those are drawn.
+func (t *Trekking) UnmarshalJSON(data []byte) error {
+	type plain Trekking
+	if err := json.Unmarshal(data, (*plain)(t)); err != nil {
+		return err
+	}
+
+	if t.Getrokken && t.State < Drawn {
+		t.State = Drawn
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package lootjestrekken
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	trekking := Trekking{}
+	assert.Equal(t, Draft, trekking.State)
+
+	assert.Equal(t, ErrInvalidTransition, trekking.Transition(Drawn))
+	assert.NoError(t, trekking.Transition(Open))
+	assert.NoError(t, trekking.Transition(Closed))
+	assert.NoError(t, trekking.Transition(Open))
+	assert.NoError(t, trekking.Transition(Closed))
+	assert.NoError(t, trekking.Transition(Drawn))
+	assert.Equal(t, ErrInvalidTransition, trekking.Transition(Drawn))
+	assert.Equal(t, ErrInvalidTransition, trekking.Transition(Open))
+	assert.NoError(t, trekking.Transition(Revealed))
+	assert.NoError(t, trekking.Transition(Archived))
+
+	for state := Draft; state <= Archived; state++ {
+		assert.Equal(t, ErrInvalidTransition, trekking.Transition(state))
+	}
+	assert.Equal(t, Archived, trekking.State)
+}
+
+func TestParseState(t *testing.T) {
+	for state := Draft; state <= Archived; state++ {
+		parsed, err := ParseState(state.String())
+		assert.NoError(t, err)
+		assert.Equal(t, state, parsed)
+	}
+
+	_, err := ParseState("locked")
+	assert.Equal(t, ErrUnknownState, err)
+}
+
+func TestLegacyGetrokken(t *testing.T) {
+	var trekking Trekking
+	assert.NoError(t, json.Unmarshal([]byte(`{"Name": "old", "People": ["a", "b"], "PeopleMapping": ["b", "a"], "Getrokken": true}`), &trekking))
+	assert.Equal(t, Drawn, trekking.State)
+	assert.Equal(t, "old", trekking.Name)
+
+	trekking = Trekking{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"Name": "new", "State": 1}`), &trekking))
+	assert.Equal(t, Open, trekking.State)
+}
+
+func TestRecordRedraw(t *testing.T) {
+	trekking := Trekking{}
+	trekking.RecordRedraw("owner", "piet joined late")
+
+	assert.Equal(t, 1, len(trekking.Redraws))
+	assert.Equal(t, "owner", trekking.Redraws[0].By)
+	assert.Equal(t, "piet joined late", trekking.Redraws[0].Reason)
+	assert.False(t, trekking.Redraws[0].At.IsZero())
+}
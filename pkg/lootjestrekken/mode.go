@@ -0,0 +1,87 @@
+package lootjestrekken
+
+import (
+	"errors"
+)
+
+// DrawMode decides which permutations a draw may produce.
+type DrawMode int
+
+const (
+	// SingleCycle draws one big cycle, so the draw can be revealed as a chain. This is the default.
+	SingleCycle DrawMode = iota
+	// Derangement allows any permutation in which nobody draws themselves, including small swaps.
+	Derangement
+	// NoTwoCycles allows any derangement in which nobody draws the person who drew them.
+	NoTwoCycles
+)
+
+var ErrUnknownDrawMode = errors.New("unknown draw mode")
+
+var drawModeNames = map[DrawMode]string{
+	SingleCycle: "cycle",
+	Derangement: "derangement",
+	NoTwoCycles: "no-2-cycles",
+}
+
+func (m DrawMode) String() string {
+	if name, ok := drawModeNames[m]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseDrawMode returns the draw mode with the given name, as returned by DrawMode.String.
+func ParseDrawMode(name string) (DrawMode, error) {
+	for mode, i := range drawModeNames {
+		if i == name {
+			return mode, nil
+		}
+	}
+	return 0, ErrUnknownDrawMode
+}
+
+// permits reports whether perm is one of the permutations this mode may produce.
+func (m DrawMode) permits(perm []int) bool {
+	switch m {
+	case Derangement:
+		for giver, receiver := range perm {
+			if giver == receiver {
+				return false
+			}
+		}
+		return true
+	case NoTwoCycles:
+		for giver, receiver := range perm {
+			if giver == receiver || perm[receiver] == giver {
+				return false
+			}
+		}
+		return true
+	default:
+		return cycleLength(perm, 0) == len(perm)
+	}
+}
+
+func cycleLength(perm []int, start int) int {
+	if len(perm) == 0 {
+		return 0
+	}
+
+	length := 1
+	for i := perm[start]; i != start; i = perm[i] {
+		length++
+	}
+	return length
+}
+
+// candidate draws a uniformly random permutation of 0..n-1 from a superset of the permutations
+// this mode permits. Single cycles come straight out of Sattolo's algorithm, the other modes are
+// filtered from a uniform shuffle.
+func (m DrawMode) candidate(r Randomness, n int) []int {
+	if m == SingleCycle {
+		return derangeIndices(r, n)
+	}
+
+	return permutation(r, n)
+}
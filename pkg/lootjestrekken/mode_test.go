@@ -0,0 +1,155 @@
+package lootjestrekken
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// samplesPerPermutation is how often every allowed permutation is expected to be drawn.
+const samplesPerPermutation = 200
+
+// chiSquareCritical approximates the chi-square value with df degrees of freedom that is only
+// exceeded with a probability of 0.0001 (Wilson-Hilferty).
+func chiSquareCritical(df int) float64 {
+	const z = 3.719
+	d := float64(df)
+	return d * math.Pow(1-2/(9*d)+z*math.Sqrt(2/(9*d)), 3)
+}
+
+// assertUniform draws permutations of n people and checks that exactly the expected number of
+// distinct permutations show up, all permitted by the mode, with a uniform distribution.
+func assertUniform(t *testing.T, mode DrawMode, n, expected int, draw func() []int) {
+	counts := map[string]int{}
+	samples := expected * samplesPerPermutation
+	for i := 0; i < samples; i++ {
+		perm := draw()
+		if !assert.True(t, mode.permits(perm), "%s drew %v", mode, perm) {
+			return
+		}
+		counts[fmt.Sprint(perm)]++
+	}
+
+	assert.Equal(t, expected, len(counts))
+
+	chi := 0.0
+	for _, c := range counts {
+		diff := float64(c - samplesPerPermutation)
+		chi += diff * diff / samplesPerPermutation
+	}
+	assert.Less(t, chi, chiSquareCritical(expected-1), "%s is not uniform over %d people", mode, n)
+}
+
+// trekked draws a trekking of n people and returns whom each person drew by index.
+func trekked(t *testing.T, mode DrawMode, n int) []int {
+	people := make([]string, n)
+	for i := range people {
+		people[i] = fmt.Sprint(i)
+	}
+
+	trekking := Trekking{People: participants(people...), Mode: mode}
+	assert.NoError(t, trekking.Trek())
+
+	perm := make([]int, n)
+	for giver, i := range people {
+		res, err := trekking.GetrokkenPerson(i)
+		assert.NoError(t, err)
+		for receiver, j := range people {
+			if j == res.ID {
+				perm[giver] = receiver
+			}
+		}
+	}
+	return perm
+}
+
+// countPermitted counts the permutations of n people that the mode permits by brute force.
+func countPermitted(mode DrawMode, n int) int {
+	count := 0
+	perm := make([]int, n)
+	used := make([]bool, n)
+
+	var walk func(giver int)
+	walk = func(giver int) {
+		if giver == n {
+			if mode.permits(perm) {
+				count++
+			}
+			return
+		}
+
+		for receiver := 0; receiver < n; receiver++ {
+			if !used[receiver] {
+				used[receiver] = true
+				perm[giver] = receiver
+				walk(giver + 1)
+				used[receiver] = false
+			}
+		}
+	}
+	walk(0)
+
+	return count
+}
+
+func TestModeCounts(t *testing.T) {
+	// of the 265 derangements of six people, 120 are a single cycle and 160 have no 2-cycles
+	expected := map[DrawMode]int{SingleCycle: 120, Derangement: 265, NoTwoCycles: 160}
+	for mode, count := range expected {
+		assert.Equal(t, count, countPermitted(mode, 6), "%s", mode)
+	}
+}
+
+func TestTrekModesUniform(t *testing.T) {
+	for _, mode := range []DrawMode{SingleCycle, Derangement, NoTwoCycles} {
+		mode := mode
+		assertUniform(t, mode, 6, countPermitted(mode, 6), func() []int {
+			return trekked(t, mode, 6)
+		})
+	}
+}
+
+func TestEnumerateModesUniform(t *testing.T) {
+	always := func(giver, receiver int) bool { return true }
+
+	for _, mode := range []DrawMode{SingleCycle, Derangement, NoTwoCycles} {
+		mode := mode
+		assertUniform(t, mode, 5, countPermitted(mode, 5), func() []int {
+			var perm []int
+			var err error
+			if mode == SingleCycle {
+				perm, err = enumerate(DefaultRandomness, 5, always, noCost)
+			} else {
+				perm, err = enumeratePermutations(DefaultRandomness, mode, 5, always, noCost)
+			}
+			assert.NoError(t, err)
+			return perm
+		})
+	}
+}
+
+func TestTrekModeImpossible(t *testing.T) {
+	trekking := Trekking{People: participants("a", "b"), Mode: NoTwoCycles}
+	assert.Equal(t, ErrNoValidAssignment, trekking.Trek())
+
+	trekking = Trekking{People: participants("a"), Mode: Derangement}
+	assert.Equal(t, ErrTooFewParticipants, trekking.Trek())
+
+	trekking = Trekking{People: participants("a", "b"), Mode: Derangement}
+	assert.NoError(t, trekking.Trek())
+	res, err := trekking.GetrokkenPerson("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", res.ID)
+}
+
+func TestParseDrawMode(t *testing.T) {
+	for _, mode := range []DrawMode{SingleCycle, Derangement, NoTwoCycles} {
+		parsed, err := ParseDrawMode(mode.String())
+		assert.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+
+	_, err := ParseDrawMode("chain")
+	assert.Equal(t, ErrUnknownDrawMode, err)
+}
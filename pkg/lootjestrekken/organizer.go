@@ -0,0 +1,80 @@
+package lootjestrekken
+
+import (
+	"errors"
+)
+
+var (
+	ErrOrganizerExists   = errors.New("organizer already exists")
+	ErrOrganizerNotFound = errors.New("organizer not found")
+)
+
+// Organizer can manage a trekking using their own secret. Only the hash of the secret is kept.
+type Organizer struct {
+	Name string
+	Hash string
+}
+
+// AddOrganizer adds an organizer and returns their secret. It returns ErrOrganizerExists when there
+// already is an organizer with the name, use RotateOrganizer to give them a new secret.
+func (t *Trekking) AddOrganizer(name string) (string, error) {
+	for _, i := range t.Organizers {
+		if i.Name == name {
+			return "", ErrOrganizerExists
+		}
+	}
+
+	secret, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	t.Organizers = append(t.Organizers, Organizer{Name: name, Hash: hash})
+	return secret, nil
+}
+
+// RotateOrganizer issues a new secret to the named organizer, replacing their earlier one.
+func (t *Trekking) RotateOrganizer(name string) (string, error) {
+	for index := range t.Organizers {
+		if t.Organizers[index].Name != name {
+			continue
+		}
+
+		secret, hash, err := newToken()
+		if err != nil {
+			return "", err
+		}
+
+		t.Organizers[index].Hash = hash
+		return secret, nil
+	}
+
+	return "", ErrOrganizerNotFound
+}
+
+// RemoveOrganizer removes the named organizer and reports whether there was one.
+func (t *Trekking) RemoveOrganizer(name string) bool {
+	for index, i := range t.Organizers {
+		if i.Name == name {
+			t.Organizers = append(t.Organizers[:index], t.Organizers[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Organizer returns the name of the organizer the secret belongs to.
+func (t *Trekking) Organizer(secret string) (string, bool) {
+	if secret == "" {
+		return "", false
+	}
+
+	for _, i := range t.Organizers {
+		if checkHash(i.Hash, secret) {
+			return i.Name, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,48 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOrganizers(t *testing.T) {
+	trekking := Trekking{}
+	owner, err := trekking.AddOrganizer("owner")
+	assert.NoError(t, err)
+	co, err := trekking.AddOrganizer("co")
+	assert.NoError(t, err)
+
+	name, ok := trekking.Organizer(owner)
+	assert.True(t, ok)
+	assert.Equal(t, "owner", name)
+
+	name, ok = trekking.Organizer(co)
+	assert.True(t, ok)
+	assert.Equal(t, "co", name)
+
+	_, ok = trekking.Organizer("")
+	assert.False(t, ok)
+
+	// adding an organizer again doesn't replace their secret
+	_, err = trekking.AddOrganizer("owner")
+	assert.Equal(t, ErrOrganizerExists, err)
+	_, ok = trekking.Organizer(owner)
+	assert.True(t, ok)
+
+	// a new secret replaces the old one
+	newco, err := trekking.RotateOrganizer("co")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(trekking.Organizers))
+	_, ok = trekking.Organizer(co)
+	assert.False(t, ok)
+	_, ok = trekking.Organizer(newco)
+	assert.True(t, ok)
+
+	_, err = trekking.RotateOrganizer("unknown")
+	assert.Equal(t, ErrOrganizerNotFound, err)
+
+	assert.True(t, trekking.RemoveOrganizer("co"))
+	assert.False(t, trekking.RemoveOrganizer("co"))
+	_, ok = trekking.Organizer(newco)
+	assert.False(t, ok)
+}
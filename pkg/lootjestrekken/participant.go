@@ -0,0 +1,215 @@
+package lootjestrekken
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// idLength is the number of random bytes in the id of a participant.
+const idLength = 6
+
+var ErrAmbiguousPerson = errors.New("several people have this name")
+
+// Participant is someone who takes part in a trekking. The ID stays the same when the display name
+// changes, and distinguishes people with the same name.
+type Participant struct {
+	ID    string
+	Name  string
+	Email string `json:",omitempty"`
+	// Attributes holds any other information about the participant, by key.
+	Attributes map[string]string `json:",omitempty"`
+}
+
+func newID() (string, error) {
+	buf := make([]byte, idLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// is reports whether ref refers to the participant, by id or by name.
+func (p Participant) is(ref string) bool {
+	return ref == p.ID || ref == p.Name
+}
+
+func (p Participant) copy() Participant {
+	if p.Attributes != nil {
+		attributes := make(map[string]string, len(p.Attributes))
+		for k, v := range p.Attributes {
+			attributes[k] = v
+		}
+		p.Attributes = attributes
+	}
+	return p
+}
+
+// UnmarshalJSON decodes a participant. Trekkingen stored before participants existed only list
+// names, those people get their name as id.
+func (p *Participant) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*p = Participant{ID: name, Name: name}
+		return nil
+	}
+
+	type plain Participant
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+func sortedParticipants(people []Participant) []Participant {
+	sorted := append([]Participant(nil), people...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+// index returns the position of the participant ref refers to. An id always wins over a name, a
+// name has to be unique.
+func (t *Trekking) index(ref string) (int, error) {
+	found := -1
+	for index, i := range t.People {
+		if i.ID == ref {
+			return index, nil
+		}
+
+		if i.Name == ref {
+			if found >= 0 {
+				return -1, ErrAmbiguousPerson
+			}
+			found = index
+		}
+	}
+
+	if found < 0 {
+		return -1, ErrPersonNotFound
+	}
+	return found, nil
+}
+
+// Participant returns the participant with ref as id, or else the only participant with ref as name.
+func (t *Trekking) Participant(ref string) (Participant, error) {
+	index, err := t.index(ref)
+	if err != nil {
+		return Participant{}, err
+	}
+
+	return t.People[index], nil
+}
+
+func (t *Trekking) HasPerson(ref string) bool {
+	_, err := t.index(ref)
+	return err == nil
+}
+
+// IDs returns the ids of all participants.
+func (t *Trekking) IDs() []string {
+	ids := make([]string, 0, len(t.People))
+	for _, i := range t.People {
+		ids = append(ids, i.ID)
+	}
+	return ids
+}
+
+// Names returns the display names of all participants.
+func (t *Trekking) Names() []string {
+	names := make([]string, 0, len(t.People))
+	for _, i := range t.People {
+		names = append(names, i.Name)
+	}
+	return names
+}
+
+// Resolve returns the id of the participant ref refers to. Rules and history can also name people
+// that aren't part of the trekking (yet), for those ref itself is returned.
+func (t *Trekking) Resolve(ref string) string {
+	if p, err := t.Participant(ref); err == nil {
+		return p.ID
+	}
+	return ref
+}
+
+// DisplayName returns the name of the participant with ref as id, or ref itself if there is none.
+func (t *Trekking) DisplayName(ref string) string {
+	for _, i := range t.People {
+		if i.ID == ref {
+			return i.Name
+		}
+	}
+	return ref
+}
+
+// AddParticipant adds a participant to the trekking, as long as it isn't getrokken yet. A
+// participant without id gets a new one.
+func (t *Trekking) AddParticipant(p Participant) (Participant, error) {
+	if t.Getrokken {
+		return Participant{}, ErrAlreadyDrawn
+	}
+
+	if p.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return Participant{}, err
+		}
+		p.ID = id
+	}
+
+	for _, i := range t.People {
+		if i.ID == p.ID {
+			return Participant{}, ErrDuplicatePerson
+		}
+	}
+
+	t.People = append(t.People, p)
+	return p, nil
+}
+
+// AddPerson adds a new participant with the given name. Several people can have the same name.
+func (t *Trekking) AddPerson(name string) (Participant, error) {
+	return t.AddParticipant(Participant{Name: name})
+}
+
+// RenamePerson changes the display name of a participant. Their id, and so their draw and rules,
+// stay the same.
+func (t *Trekking) RenamePerson(ref, name string) error {
+	index, err := t.index(ref)
+	if err != nil {
+		return err
+	}
+
+	t.People[index].Name = name
+	return nil
+}
+
+func (t *Trekking) SetEmail(ref, email string) error {
+	index, err := t.index(ref)
+	if err != nil {
+		return err
+	}
+
+	t.People[index].Email = email
+	return nil
+}
+
+// SetAttribute sets a custom attribute of a participant. An empty value removes the attribute.
+func (t *Trekking) SetAttribute(ref, key, value string) error {
+	index, err := t.index(ref)
+	if err != nil {
+		return err
+	}
+
+	p := &t.People[index]
+	if value == "" {
+		delete(p.Attributes, key)
+		return nil
+	}
+
+	if p.Attributes == nil {
+		p.Attributes = map[string]string{}
+	}
+	p.Attributes[key] = value
+	return nil
+}
@@ -0,0 +1,106 @@
+package lootjestrekken
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// participants returns participants that have their name as id, like those of old trekkingen.
+func participants(names ...string) []Participant {
+	people := make([]Participant, 0, len(names))
+	for _, i := range names {
+		people = append(people, Participant{ID: i, Name: i})
+	}
+	return people
+}
+
+func TestParticipants(t *testing.T) {
+	trekking := Trekking{}
+	first, err := trekking.AddPerson("jan")
+	assert.NoError(t, err)
+	second, err := trekking.AddPerson("jan")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	_, err = trekking.Participant("jan")
+	assert.Equal(t, ErrAmbiguousPerson, err)
+	_, err = trekking.Participant("piet")
+	assert.Equal(t, ErrPersonNotFound, err)
+
+	p, err := trekking.Participant(second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, second, p)
+
+	// fixing a typo keeps the id
+	assert.NoError(t, trekking.RenamePerson(second.ID, "janneke"))
+	p, err = trekking.Participant("janneke")
+	assert.NoError(t, err)
+	assert.Equal(t, second.ID, p.ID)
+	assert.Equal(t, []string{"jan", "janneke"}, trekking.Names())
+
+	assert.NoError(t, trekking.SetEmail("jan", "jan@example.com"))
+	assert.NoError(t, trekking.SetAttribute("jan", "size", "L"))
+	p, err = trekking.Participant(first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "jan@example.com", p.Email)
+	assert.Equal(t, map[string]string{"size": "L"}, p.Attributes)
+
+	assert.NoError(t, trekking.SetAttribute("jan", "size", ""))
+	p, err = trekking.Participant(first.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, p.Attributes)
+
+	_, err = trekking.AddParticipant(Participant{ID: first.ID, Name: "klaas"})
+	assert.Equal(t, ErrDuplicatePerson, err)
+}
+
+func TestParticipantsDraw(t *testing.T) {
+	trekking := Trekking{}
+	jan, _ := trekking.AddPerson("jan")
+	_, _ = trekking.AddPerson("jan")
+	piet, _ := trekking.AddPerson("piet")
+	_, _ = trekking.AddPerson("klaas")
+
+	// an exclusion added by name refers to the id once the person is known
+	trekking.AddExclusion(jan.ID, "piet")
+	assert.Equal(t, []Exclusion{{A: jan.ID, B: piet.ID}}, trekking.Exclusions)
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, trekking.TrekWith(DefaultRandomness))
+		res, err := trekking.GetrokkenPerson(jan.ID)
+		assert.NoError(t, err)
+		assert.NotEqual(t, piet.ID, res.ID)
+		assert.NotEqual(t, jan.ID, res.ID)
+	}
+}
+
+func TestLinkedDraw(t *testing.T) {
+	previous := Trekking{People: []Participant{{ID: "1", Name: "a"}, {ID: "2", Name: "b"}}, PeopleMapping: []string{"2", "1"}, Getrokken: true}
+
+	// a clone shares the ids
+	clone := previous.Clone()
+	assert.Equal(t, PastDraw{People: []string{"1", "2"}, PeopleMapping: []string{"2", "1"}}, clone.LinkedDraw(previous))
+
+	// a separate trekking is matched by name
+	separate := Trekking{People: []Participant{{ID: "3", Name: "b"}, {ID: "4", Name: "a"}}}
+	assert.Equal(t, PastDraw{People: []string{"4", "3"}, PeopleMapping: []string{"3", "4"}}, separate.LinkedDraw(previous))
+}
+
+func TestParticipantsMigration(t *testing.T) {
+	var trekking Trekking
+	assert.NoError(t, json.Unmarshal([]byte(`{"People": ["a", "b"], "PeopleMapping": ["b", "a"], "Getrokken": true, "Tokens": {"a": "hash"}}`), &trekking))
+	assert.Equal(t, participants("a", "b"), trekking.People)
+
+	res, err := trekking.GetrokkenPerson("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", res.Name)
+	assert.Contains(t, trekking.Tokens, "a")
+
+	encoded, err := json.Marshal(trekking)
+	assert.NoError(t, err)
+
+	var again Trekking
+	assert.NoError(t, json.Unmarshal(encoded, &again))
+	assert.Equal(t, trekking.People, again.People)
+}
@@ -0,0 +1,76 @@
+package lootjestrekken
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// Randomness is the source of every random choice made during a draw.
+type Randomness interface {
+	// Intn returns a uniformly random number in [0, n). It panics if n <= 0.
+	Intn(n int) int
+}
+
+// DefaultRandomness is used by Trek and Derange.
+var DefaultRandomness Randomness = CryptoRandomness{}
+
+// CryptoRandomness draws from crypto/rand, so draws can't be predicted.
+type CryptoRandomness struct{}
+
+func (CryptoRandomness) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+
+	// reject the top of the range that doesn't divide evenly, so every number is equally likely
+	max := ^uint64(0) - ^uint64(0)%uint64(n)
+	var buf [8]byte
+	for {
+		if _, err := crand.Read(buf[:]); err != nil {
+			panic(err)
+		}
+
+		if v := binary.LittleEndian.Uint64(buf[:]); v < max {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// SeededRandomness is a deterministic source, so a draw can be replayed from its seed.
+type SeededRandomness struct {
+	rand *rand.Rand
+	sync.Mutex
+}
+
+func NewSeededRandomness(seed int64) *SeededRandomness {
+	return &SeededRandomness{
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (s *SeededRandomness) Intn(n int) int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.rand.Intn(n)
+}
+
+// shuffle is the Fisher-Yates shuffle.
+func shuffle(r Randomness, n int, swap func(i, j int)) {
+	for i := n - 1; i >= 1; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
+
+// permutation returns a uniformly random permutation of the indices 0..n-1.
+func permutation(r Randomness, n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+
+	shuffle(r, n, func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+	return perm
+}
@@ -0,0 +1,48 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSeededReplay(t *testing.T) {
+	people := []string{"a", "b", "c", "d", "e", "f"}
+
+	first := Trekking{People: participants(people...), Mode: Derangement}
+	assert.NoError(t, first.TrekWith(NewSeededRandomness(42)))
+
+	second := Trekking{People: participants(people...), Mode: Derangement}
+	assert.NoError(t, second.TrekWith(NewSeededRandomness(42)))
+
+	assert.Equal(t, first.People, second.People)
+	assert.Equal(t, first.PeopleMapping, second.PeopleMapping)
+
+	assert.Equal(t, DerangeWith(NewSeededRandomness(7), people), DerangeWith(NewSeededRandomness(7), people))
+}
+
+func TestCryptoIntn(t *testing.T) {
+	counts := make([]int, 6)
+	for i := 0; i < 60000; i++ {
+		counts[CryptoRandomness{}.Intn(6)]++
+	}
+
+	for _, c := range counts {
+		assert.InDelta(t, 10000, c, 500)
+	}
+
+	assert.Panics(t, func() { CryptoRandomness{}.Intn(0) })
+}
+
+func TestPermutationUniform(t *testing.T) {
+	r := NewSeededRandomness(1)
+	counts := map[[3]int]int{}
+	for i := 0; i < 60000; i++ {
+		perm := permutation(r, 3)
+		counts[[3]int{perm[0], perm[1], perm[2]}]++
+	}
+
+	assert.Equal(t, 6, len(counts))
+	for _, c := range counts {
+		assert.InDelta(t, 10000, c, 500)
+	}
+}
@@ -0,0 +1,504 @@
+package lootjestrekken
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrNoValidAssignment = errors.New("no assignment satisfies the exclusion rules")
+var ErrSearchExhausted = errors.New("no assignment was found within the search budget, though the exclusion rules may allow one")
+
+// maxRejections is how many random draws are tried before falling back to an exhaustive search.
+const maxRejections = 10000
+
+// searchBudget bounds the exhaustive search, which grows factorially with the number of people. Every
+// partial permutation it visits costs about as much as checking that the people left can be placed.
+// Trekkingen in which a single walk down to a full permutation costs more than that, those of more
+// than about 300 people, aren't searched at all.
+const searchBudget = 10000000
+
+// derangeIndices runs Sattolo's algorithm on the indices 0..n-1. Position i of the result holds
+// the index of the person drawn by person i.
+func derangeIndices(r Randomness, n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+
+	for i := n - 1; i >= 1; i-- {
+		j := r.Intn(i)
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+
+	return perm
+}
+
+func valid(perm []int, allowed func(giver, receiver int) bool) bool {
+	for giver, receiver := range perm {
+		if !allowed(giver, receiver) {
+			return false
+		}
+	}
+	return true
+}
+
+// assign picks a random permutation over n people, out of the ones the mode permits, in which every
+// giver is allowed to draw their receiver and the total cost is as low as possible. Rules that leave
+// no draw at all are rejected up front with ErrNoValidAssignment. Otherwise random draws are rejected
+// until one satisfies the rules at zero cost, which draws uniformly. When that keeps failing, the
+// valid permutations are enumerated instead, and a search that completes draws uniformly as well.
+// When searchBudget runs out the search draws from the cheapest permutations it found so far, which is
+// only uniform over those, and only when no permutation can cost less, see lowestCost. Otherwise, or
+// when the trekking is too large to search, construct builds a draw out of a matching of the pairs
+// that cost nothing. ErrSearchExhausted means that failed too, so the draw with the lowest cost
+// wasn't found.
+//
+// allowed and cost are asked for the same pairs over and over, so they should look them up.
+func assign(r Randomness, mode DrawMode, n int, allowed func(giver, receiver int) bool, cost func(giver, receiver int) int) ([]int, error) {
+	everyone := unused(make([]bool, n))
+	if !matchable(everyone, everyone, allowed) {
+		return nil, ErrNoValidAssignment
+	}
+
+	free := func(giver, receiver int) bool {
+		return allowed(giver, receiver) && cost(giver, receiver) == 0
+	}
+
+	for attempt := 0; attempt < maxRejections; attempt++ {
+		perm := mode.candidate(r, n)
+		if mode.permits(perm) && valid(perm, free) {
+			return perm, nil
+		}
+	}
+
+	if walkCost(n) <= searchBudget {
+		var perm []int
+		var err error
+		if mode == SingleCycle {
+			perm, err = enumerate(r, n, allowed, cost)
+		} else {
+			perm, err = enumeratePermutations(r, mode, n, allowed, cost)
+		}
+		if err != ErrSearchExhausted {
+			return perm, err
+		}
+	}
+
+	// without a search only a draw that costs nothing is known to cost as little as possible
+	perm, err := construct(mode, n, free)
+	if err != nil {
+		return nil, ErrSearchExhausted
+	}
+	return perm, nil
+}
+
+// walkCost is what the search pays for a single walk from nobody placed down to n people placed.
+func walkCost(n int) int {
+	cost := 0
+	for left := 0; left <= n; left++ {
+		cost += n + left*left
+	}
+	return cost
+}
+
+// matchable reports whether every giver can draw a different one of the receivers. Every draw is
+// such a matching, so this rejects rules like a giver who may draw nobody, or a household holding
+// more than half of the people, without searching.
+func matchable(givers, receivers []int, allowed func(giver, receiver int) bool) bool {
+	return matching(givers, receivers, allowed) != nil
+}
+
+// matching finds a perfect matching of givers to receivers with augmenting paths. It returns the
+// giver matched to every receiver, by position in receivers, or nil when there is no such matching.
+// The paths are searched in phases, every phase tries all givers that are left and marks every
+// receiver at most once, which keeps large trekkingen fast.
+func matching(givers, receivers []int, allowed func(giver, receiver int) bool) []int {
+	if len(givers) != len(receivers) {
+		return nil
+	}
+
+	// giverOf holds the position in givers of the giver matched to every receiver, or -1
+	giverOf := make([]int, len(receivers))
+	for i := range giverOf {
+		giverOf[i] = -1
+	}
+	matched := make([]bool, len(givers))
+	seen := make([]int, len(receivers))
+	phase := 0
+
+	var augment func(g int) bool
+	augment = func(g int) bool {
+		giver := givers[g]
+		// a receiver nobody drew yet ends the path right away
+		for index, receiver := range receivers {
+			if giverOf[index] < 0 && seen[index] != phase && receiver != giver && allowed(giver, receiver) {
+				seen[index] = phase
+				giverOf[index] = g
+				return true
+			}
+		}
+
+		for index, receiver := range receivers {
+			if seen[index] == phase || receiver == giver || !allowed(giver, receiver) {
+				continue
+			}
+
+			seen[index] = phase
+			if augment(giverOf[index]) {
+				giverOf[index] = g
+				return true
+			}
+		}
+		return false
+	}
+
+	for left := len(givers); left > 0; {
+		phase++
+		found := false
+		for g := range givers {
+			if !matched[g] && augment(g) {
+				matched[g] = true
+				left--
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	for index, g := range giverOf {
+		giverOf[index] = givers[g]
+	}
+	return giverOf
+}
+
+// construct builds a draw the mode permits without searching. A matching of everyone is a draw that
+// may consist of several cycles, and two cycles become one when a giver of each can draw the receiver
+// of the other. Cycles are joined that way until the mode permits the draw, or until no more can be
+// joined, and then construct returns ErrSearchExhausted. Its draws are not uniform.
+func construct(mode DrawMode, n int, allowed func(giver, receiver int) bool) ([]int, error) {
+	everyone := unused(make([]bool, n))
+	giverOf := matching(everyone, everyone, allowed)
+	if giverOf == nil {
+		return nil, ErrNoValidAssignment
+	}
+
+	perm := make([]int, n)
+	for receiver, giver := range giverOf {
+		perm[giver] = receiver
+	}
+	if mode == Derangement {
+		return perm, nil
+	}
+
+	c := newCycles(perm)
+	for joined := true; joined && !mode.permits(perm); {
+		joined = false
+		for a := 0; a < n; a++ {
+			for b := a + 1; b < n; b++ {
+				ca, cb := c.find(a), c.find(b)
+				if ca == cb || (mode == NoTwoCycles && c.size[ca] != 2 && c.size[cb] != 2) {
+					continue
+				}
+
+				if allowed(a, perm[b]) && allowed(b, perm[a]) {
+					perm[a], perm[b] = perm[b], perm[a]
+					c.join(ca, cb)
+					joined = true
+				}
+			}
+		}
+	}
+
+	if !mode.permits(perm) {
+		return nil, ErrSearchExhausted
+	}
+	return perm, nil
+}
+
+// cycles keeps track of which people are in the same cycle of a permutation, as a union-find.
+type cycles struct {
+	parent []int
+	// size is the length of the cycle, for the people that parent points at themselves
+	size []int
+}
+
+func newCycles(perm []int) *cycles {
+	c := &cycles{parent: make([]int, len(perm)), size: make([]int, len(perm))}
+	for i := range perm {
+		c.parent[i] = i
+		c.size[i] = 1
+	}
+	for giver, receiver := range perm {
+		if a, b := c.find(giver), c.find(receiver); a != b {
+			c.join(a, b)
+		}
+	}
+	return c
+}
+
+func (c *cycles) find(i int) int {
+	for c.parent[i] != i {
+		c.parent[i] = c.parent[c.parent[i]]
+		i = c.parent[i]
+	}
+	return i
+}
+
+// join makes the cycles of a and b, which have to be found with find, one cycle.
+func (c *cycles) join(a, b int) {
+	if c.size[a] < c.size[b] {
+		a, b = b, a
+	}
+	c.parent[b] = a
+	c.size[a] += c.size[b]
+}
+
+// unused returns the people that used doesn't mark, followed by extra.
+func unused(used []bool, extra ...int) []int {
+	people := make([]int, 0, len(used)+len(extra))
+	for i, u := range used {
+		if !u {
+			people = append(people, i)
+		}
+	}
+	return append(people, extra...)
+}
+
+func noCost(giver, receiver int) int {
+	return 0
+}
+
+// lowestCost returns the lowest total cost of a matching in which everyone draws someone else they
+// are allowed to draw, found with the Hungarian algorithm. Every draw is such a matching, so no draw
+// costs less, and for Derangement the cheapest draw costs exactly this. There has to be a matching.
+func lowestCost(n int, allowed func(giver, receiver int) bool, cost func(giver, receiver int) int) int {
+	// a pair that isn't allowed costs more than any matching of allowed pairs
+	const forbidden, infinite = 1 << 40, 1 << 62
+	price := func(giver, receiver int) int {
+		if giver == receiver || !allowed(giver, receiver) {
+			return forbidden
+		}
+		return cost(giver, receiver)
+	}
+
+	// givers and receivers are numbered from 1, receiver 0 is where every augmenting path starts
+	u := make([]int, n+1)
+	v := make([]int, n+1)
+	giverOf := make([]int, n+1)
+	way := make([]int, n+1)
+	for giver := 1; giver <= n; giver++ {
+		giverOf[0] = giver
+		minv := make([]int, n+1)
+		for i := range minv {
+			minv[i] = infinite
+		}
+		used := make([]bool, n+1)
+
+		current := 0
+		for giverOf[current] != 0 {
+			used[current] = true
+			from := giverOf[current]
+			delta, next := infinite, 0
+			for receiver := 1; receiver <= n; receiver++ {
+				if used[receiver] {
+					continue
+				}
+				if reduced := price(from-1, receiver-1) - u[from] - v[receiver]; reduced < minv[receiver] {
+					minv[receiver] = reduced
+					way[receiver] = current
+				}
+				if minv[receiver] < delta {
+					delta, next = minv[receiver], receiver
+				}
+			}
+
+			for receiver := 0; receiver <= n; receiver++ {
+				if used[receiver] {
+					u[giverOf[receiver]] += delta
+					v[receiver] -= delta
+				} else {
+					minv[receiver] -= delta
+				}
+			}
+			current = next
+		}
+
+		for current != 0 {
+			previous := way[current]
+			giverOf[current] = giverOf[previous]
+			current = previous
+		}
+	}
+
+	total := 0
+	for receiver := 1; receiver <= n; receiver++ {
+		total += price(giverOf[receiver]-1, receiver-1)
+	}
+	return total
+}
+
+// cheapest returns the receivers that giver may still draw, the cheapest first.
+func cheapest(giver int, used []bool, allowed func(giver, receiver int) bool, cost func(giver, receiver int) int) []int {
+	var receivers []int
+	for receiver, u := range used {
+		if !u && receiver != giver && allowed(giver, receiver) {
+			receivers = append(receivers, receiver)
+		}
+	}
+	sort.SliceStable(receivers, func(i, j int) bool {
+		return cost(giver, receivers[i]) < cost(giver, receivers[j])
+	})
+	return receivers
+}
+
+// sampler reservoir samples one of the permutations with the lowest total cost it is offered.
+type sampler struct {
+	rand Randomness
+	// lowest returns what the cheapest permutation costs at least, it is only asked when the search
+	// stopped early
+	lowest func() int
+	chosen []int
+	count  int
+	best   int
+	// spent is the part of searchBudget that the search used
+	spent int
+	// exhausted is set when the search stopped because searchBudget ran out
+	exhausted bool
+}
+
+// visit pays for a partial permutation of n people with left people left to place, and reports
+// whether the search may go on.
+func (s *sampler) visit(n, left int) bool {
+	s.spent += n + left*left
+	if s.spent > searchBudget {
+		s.exhausted = true
+	}
+	return !s.exhausted
+}
+
+// prune reports whether a partial permutation that already costs total can be skipped.
+func (s *sampler) prune(total int) bool {
+	return s.count > 0 && total > s.best
+}
+
+func (s *sampler) offer(perm []int, total int) {
+	if s.prune(total) {
+		return
+	}
+
+	if s.count == 0 || total < s.best {
+		s.best = total
+		s.count = 0
+	}
+
+	s.count++
+	if s.rand.Intn(s.count) == 0 {
+		s.chosen = append(s.chosen[:0], perm...)
+	}
+}
+
+// result returns the permutation that was picked, ErrSearchExhausted when the search stopped before
+// it found one that is known to be the cheapest, and ErrNoValidAssignment when there is none.
+func (s *sampler) result() ([]int, error) {
+	switch {
+	case s.count > 0 && (!s.exhausted || s.best == 0 || s.best <= s.lowest()):
+		return s.chosen, nil
+	case s.exhausted:
+		return nil, ErrSearchExhausted
+	default:
+		return nil, ErrNoValidAssignment
+	}
+}
+
+// enumerate walks the cycles starting at person 0, cheapest receivers first, until searchBudget runs
+// out, and reservoir samples one of the valid cycles with the lowest total cost.
+func enumerate(r Randomness, n int, allowed func(giver, receiver int) bool, cost func(giver, receiver int) int) ([]int, error) {
+	if n == 0 {
+		return []int{}, nil
+	}
+
+	s := sampler{rand: r, lowest: func() int { return lowestCost(n, allowed, cost) }}
+
+	perm := make([]int, n)
+	used := make([]bool, n)
+	used[0] = true
+
+	var walk func(current, depth, total int)
+	walk = func(current, depth, total int) {
+		if !s.visit(n, n-depth) || s.prune(total) {
+			return
+		}
+
+		// the rest of the cycle, from current through the unused people back to 0, has to be possible
+		if !matchable(unused(used, current), unused(used, 0), allowed) {
+			return
+		}
+
+		if depth == n {
+			if !allowed(current, 0) {
+				return
+			}
+			perm[current] = 0
+			s.offer(perm, total+cost(current, 0))
+			return
+		}
+
+		for _, next := range cheapest(current, used, allowed, cost) {
+			used[next] = true
+			perm[current] = next
+			walk(next, depth+1, total+cost(current, next))
+			used[next] = false
+		}
+	}
+	walk(0, 1, 0)
+
+	return s.result()
+}
+
+// enumeratePermutations walks the permutations the mode permits, giver by giver and cheapest receivers
+// first, until searchBudget runs out, and reservoir samples one of the valid permutations with the
+// lowest total cost.
+func enumeratePermutations(r Randomness, mode DrawMode, n int, allowed func(giver, receiver int) bool, cost func(giver, receiver int) int) ([]int, error) {
+	s := sampler{rand: r, lowest: func() int { return lowestCost(n, allowed, cost) }}
+
+	perm := make([]int, n)
+	used := make([]bool, n)
+
+	var walk func(giver, total int)
+	walk = func(giver, total int) {
+		if !s.visit(n, n-giver) || s.prune(total) {
+			return
+		}
+
+		// the givers that are left have to be able to draw the receivers that are left
+		givers := make([]int, 0, n-giver)
+		for i := giver; i < n; i++ {
+			givers = append(givers, i)
+		}
+		if !matchable(givers, unused(used), allowed) {
+			return
+		}
+
+		if giver == n {
+			s.offer(perm, total)
+			return
+		}
+
+		for _, receiver := range cheapest(giver, used, allowed, cost) {
+			// receivers before this giver have already drawn someone
+			if mode == NoTwoCycles && receiver < giver && perm[receiver] == giver {
+				continue
+			}
+
+			used[receiver] = true
+			perm[giver] = receiver
+			walk(giver+1, total+cost(giver, receiver))
+			used[receiver] = false
+		}
+	}
+	walk(0, 0)
+
+	return s.result()
+}
@@ -0,0 +1,58 @@
+package lootjestrekken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// tokenLength is the number of random bytes in a personal token.
+const tokenLength = 24
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns an unguessable token and its hash.
+func newToken() (string, string, error) {
+	buf := make([]byte, tokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func checkHash(hash, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(token))) == 1
+}
+
+// IssueToken gives the participant with the given id a new unguessable token, replacing any earlier
+// one. Only the hash of the token is kept, so the token has to be handed to the person right away.
+func (t *Trekking) IssueToken(id string) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if t.Tokens == nil {
+		t.Tokens = map[string]string{}
+	}
+	t.Tokens[id] = hash
+
+	return token, nil
+}
+
+// CheckToken reports whether token is the token issued to the participant with the given id.
+func (t *Trekking) CheckToken(id, token string) bool {
+	hash, ok := t.Tokens[id]
+	if !ok || token == "" {
+		return false
+	}
+
+	return checkHash(hash, token)
+}
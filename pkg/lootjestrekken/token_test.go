@@ -0,0 +1,33 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	trekking := Trekking{}
+	a, err := trekking.AddPerson("a")
+	assert.NoError(t, err)
+	b, err := trekking.AddPerson("b")
+	assert.NoError(t, err)
+
+	tokenA, err := trekking.IssueToken(a.ID)
+	assert.NoError(t, err)
+	tokenB, err := trekking.IssueToken(b.ID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, tokenA, tokenB)
+
+	// only the hash is kept
+	assert.False(t, strings.Contains(trekking.Tokens[a.ID], tokenA))
+
+	assert.True(t, trekking.CheckToken(a.ID, tokenA))
+	assert.False(t, trekking.CheckToken(a.ID, tokenB))
+	assert.False(t, trekking.CheckToken(a.ID, ""))
+	assert.False(t, trekking.CheckToken("c", tokenA))
+
+	assert.NoError(t, trekking.RemovePerson("a"))
+	assert.False(t, trekking.CheckToken(a.ID, tokenA))
+	assert.True(t, trekking.CheckToken(b.ID, tokenB))
+}
@@ -0,0 +1,21 @@
+package lootjestrekken
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Trash marks the trekking as deleted at the given time.
+func (t *Trekking) Trash(at time.Time) {
+	t.DeletedAt = gorm.DeletedAt{Time: at, Valid: true}
+}
+
+// Restore marks a trashed trekking as no longer deleted.
+func (t *Trekking) Restore() {
+	t.DeletedAt = gorm.DeletedAt{}
+}
+
+// TrashedBefore reports whether the trekking was deleted before the given time.
+func (t *Trekking) TrashedBefore(before time.Time) bool {
+	return t.DeletedAt.Valid && t.DeletedAt.Time.Before(before)
+}
@@ -0,0 +1,20 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	now := time.Now()
+	trekking := Trekking{}
+	assert.False(t, trekking.TrashedBefore(now))
+
+	trekking.Trash(now.Add(-time.Hour))
+	assert.True(t, trekking.TrashedBefore(now))
+	assert.False(t, trekking.TrashedBefore(now.Add(-2*time.Hour)))
+
+	trekking.Restore()
+	assert.False(t, trekking.TrashedBefore(now))
+}
@@ -6,7 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
-	"math/rand"
+)
+
+var (
+	ErrPersonNotFound     = errors.New("person is not part of trekking")
+	ErrDuplicatePerson    = errors.New("person is already part of trekking")
+	ErrTooFewParticipants = errors.New("trekking needs at least two people")
+	ErrAlreadyDrawn       = errors.New("trekking is already getrokken")
+	ErrNotDrawn           = errors.New("trekking is not getrokken yet")
 )
 
 func lpad(s string, pad string, plength int) string {
@@ -18,14 +25,41 @@ func lpad(s string, pad string, plength int) string {
 
 type Trekking struct {
 	gorm.Model
-	People        []string
+	// Version counts the changes to the trekking, so that concurrent changes can be detected.
+	Version uint64
+	People  []Participant
+	// PeopleMapping holds the id of the participant every participant in People drew.
 	PeopleMapping []string
 	Getrokken     bool
 	Name          string
-}
-
-func (t *Trekking) AddPerson(name string) {
-	t.People = append(t.People, name)
+	Exclusions    []Exclusion
+	Households    []Household
+
+	// Previous names earlier trekkingen, oldest first, whose draws should not be repeated.
+	Previous []string
+	// History holds explicitly supplied earlier draws, in the order they were added.
+	History []PastDraw
+	// HistoryYears limits how many of the most recent earlier draws are avoided. 0 means all of them.
+	HistoryYears int
+	// Mode decides which permutations the draw may produce.
+	Mode DrawMode
+
+	// Commitment is the published hash of Seed and Inputs of an auditable draw.
+	Commitment string
+	// Seed is the secret seed an auditable draw is made with. It may only be shown once Revealed.
+	Seed []byte
+	// Inputs are what the auditable draw was committed to, published with the seed.
+	Inputs   *AuditInputs `json:",omitempty"`
+	Revealed bool
+
+	// Tokens holds the hash of the personal token of every person, by id.
+	Tokens map[string]string
+	// Organizers may manage the trekking. Trekkingen from before organizers existed have none.
+	Organizers []Organizer
+
+	State State
+	// Redraws is the audit log of every time the trekking was drawn again after its draw.
+	Redraws []Redraw
 }
 
 func (t *Trekking) GetInfo() string {
@@ -36,46 +70,96 @@ func (t *Trekking) GetInfo() string {
 	}
 }
 
-func (t *Trekking) RemovePerson(name string) {
-	found := false
-	for index, i := range t.People {
-		if found {
-			t.People[index-1] = t.People[index]
-		} else if i == name {
-			found = true
-		}
+// RemovePerson removes a person and their personal token from the trekking, as long as it isn't
+// getrokken yet.
+func (t *Trekking) RemovePerson(ref string) error {
+	if t.Getrokken {
+		return ErrAlreadyDrawn
+	}
+
+	index, err := t.index(ref)
+	if err != nil {
+		return err
 	}
 
-	t.People = t.People[:len(t.People)-1]
+	delete(t.Tokens, t.People[index].ID)
+	t.People = append(t.People[:index], t.People[index+1:]...)
+	return nil
 }
 
-func (t *Trekking) Trek() {
-	t.Getrokken = true
+// Trek draws the trekking using DefaultRandomness. Pairs from earlier draws, both from the explicit
+// History and from the draws of the linked Previous trekkingen passed in as linked, are avoided
+// wherever possible. When they can't all be avoided the draw has as few repeats as possible.
+func (t *Trekking) Trek(linked ...PastDraw) error {
+	return t.TrekWith(DefaultRandomness, linked...)
+}
 
-	// First shuffle the people
-	rand.Shuffle(len(t.People), func(i, j int) { t.People[i], t.People[j] = t.People[j], t.People[i] })
+// TrekWith draws the trekking like Trek, taking every random choice from r.
+func (t *Trekking) TrekWith(r Randomness, linked ...PastDraw) error {
+	if len(t.People) < 2 {
+		return ErrTooFewParticipants
+	}
 
-	// then derange them into a second array
-	t.PeopleMapping = Derange(t.People)
+	// First shuffle the people, a copy of them so that a draw that fails leaves them as they were
+	people := append([]Participant(nil), t.People...)
+	shuffle(r, len(people), func(i, j int) { people[i], people[j] = people[j], people[i] })
+
+	cost := noCost
+	if draws := t.recentDraws(linked); len(draws) > 0 {
+		repeats := repeatedPairs(draws, people)
+		cost = func(giver, receiver int) int {
+			return repeats[giver][receiver]
+		}
+	}
+
+	// then derange them according to the draw mode, respecting the exclusion rules
+	excluded := t.excludedPairs(people)
+	perm, err := assign(r, t.Mode, len(people), func(giver, receiver int) bool {
+		return !excluded[giver][receiver]
+	}, cost)
+	if err != nil {
+		return err
+	}
+
+	t.People = people
+	t.PeopleMapping = make([]string, len(people))
+	for giver, receiver := range perm {
+		t.PeopleMapping[giver] = people[receiver].ID
+	}
+
+	t.Getrokken = true
+	return nil
 }
 
-func (t *Trekking) GetrokkenPerson(name string) (string, error) {
-	for index, i := range t.People {
-		if i == name {
-			return t.PeopleMapping[index], nil
+// GetrokkenPerson returns the participant that the participant ref refers to drew.
+func (t *Trekking) GetrokkenPerson(ref string) (Participant, error) {
+	if !t.Getrokken || len(t.PeopleMapping) != len(t.People) {
+		return Participant{}, ErrNotDrawn
+	}
+
+	index, err := t.index(ref)
+	if err != nil {
+		return Participant{}, err
+	}
+
+	for _, i := range t.People {
+		if i.ID == t.PeopleMapping[index] {
+			return i, nil
 		}
 	}
 
-	return "", errors.New("not part of trekking")
+	return Participant{}, ErrPersonNotFound
 }
 
 func Derange(arr []string) []string{
-	newarr := make([]string, len(arr))
-	copy(newarr, arr)
+	return DerangeWith(DefaultRandomness, arr)
+}
 
-	for i := len(arr)-1; i >= 1; i-- {
-		j := rand.Intn(i)
-		newarr[i], newarr[j] = newarr[j], newarr[i]
+// DerangeWith deranges arr like Derange, taking every random choice from r.
+func DerangeWith(r Randomness, arr []string) []string {
+	newarr := make([]string, len(arr))
+	for index, i := range derangeIndices(r, len(arr)) {
+		newarr[index] = arr[i]
 	}
 
 	return newarr
@@ -0,0 +1,40 @@
+package lootjestrekken
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPeople(t *testing.T) {
+	trekking := Trekking{People: participants("a", "b", "c")}
+	_, err := trekking.AddParticipant(Participant{ID: "b", Name: "b"})
+	assert.Equal(t, ErrDuplicatePerson, err)
+
+	// removing someone who isn't there leaves everyone else in place
+	assert.Equal(t, ErrPersonNotFound, trekking.RemovePerson("d"))
+	assert.Equal(t, []string{"a", "b", "c"}, trekking.Names())
+
+	assert.NoError(t, trekking.RemovePerson("b"))
+	assert.Equal(t, []string{"a", "c"}, trekking.Names())
+
+	_, err = trekking.GetrokkenPerson("a")
+	assert.Equal(t, ErrNotDrawn, err)
+
+	assert.NoError(t, trekking.Trek())
+	_, err = trekking.GetrokkenPerson("d")
+	assert.Equal(t, ErrPersonNotFound, err)
+
+	_, err = trekking.AddPerson("d")
+	assert.Equal(t, ErrAlreadyDrawn, err)
+	assert.Equal(t, ErrAlreadyDrawn, trekking.RemovePerson("a"))
+}
+
+func TestTooFewParticipants(t *testing.T) {
+	trekking := Trekking{}
+	assert.Equal(t, ErrTooFewParticipants, trekking.Trek())
+
+	_, err := trekking.AddPerson("a")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrTooFewParticipants, trekking.Trek())
+	assert.False(t, trekking.Getrokken)
+}